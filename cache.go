@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/artemnikitin/vulnedock/scanner"
+	"github.com/docker/docker/api/types"
+)
+
+// imageCache contains results of scan for images, so containers created
+// from the same image are scanned only once during the run
+type imageCache struct {
+	mu      sync.Mutex
+	entries map[string]*imageCacheEntry
+}
+
+type imageCacheEntry struct {
+	ready chan struct{}
+	owner string
+	res   *scanner.ContainerResult
+	err   error
+}
+
+func newImageCache() *imageCache {
+	return &imageCache{entries: make(map[string]*imageCacheEntry)}
+}
+
+// scan returns cached result for image of container or calls scan and caches its result.
+// Failed scans are not shared, since error can be specific for a container.
+func (c *imageCache) scan(container types.Container, scan func() (*scanner.ContainerResult, error)) (*scanner.ContainerResult, error) {
+	if container.ImageID == "" {
+		return scan()
+	}
+
+	c.mu.Lock()
+	e, ok := c.entries[container.ImageID]
+	if !ok {
+		e = &imageCacheEntry{ready: make(chan struct{}), owner: container.ID}
+		c.entries[container.ImageID] = e
+		c.mu.Unlock()
+
+		e.res, e.err = scan()
+		close(e.ready)
+		return e.res, e.err
+	}
+	c.mu.Unlock()
+
+	<-e.ready
+	if e.err != nil {
+		return scan()
+	}
+
+	infof("Container %s shares result with container %s for image %s", container.ID, e.owner, container.ImageID)
+	res := *e.res
+	// Findings of result are sorted in place after the scan
+	res.Vulnerabilities = *copyVulnerabilities(&e.res.Vulnerabilities)
+	res.ID = container.ID
+	res.Names = scanner.ContainerNames(container)
+	res.Image = container.Image
+	res.Service = scanner.ContainerService(container)
+	// Container wasn't scanned itself, so it doesn't have own latency
+	res.ExecLatencyMs, res.VulnersLatencyMs = 0, 0
+	return &res, nil
+}
+
+// requestCache shares Vulners responses between containers with the same OS, version and packages,
+// e.g. containers of different images built on the same base image. Vulners audit API accepts
+// only one set of packages per request and returns CVE aggregated for the whole set, so requests
+// for different sets can't be batched together without losing which container CVE belongs to.
+// Responses of software API for language packages are shared the same way.
+type requestCache struct {
+	client   scanner.Client
+	software scanner.SoftwareClient
+	mu       sync.Mutex
+	entries  map[string]*requestCacheEntry
+}
+
+type requestCacheEntry struct {
+	ready chan struct{}
+	vulns *scanner.Vulnerabilities
+	err   error
+}
+
+func newRequestCache(client scanner.Client, software scanner.SoftwareClient) *requestCache {
+	return &requestCache{client: client, software: software, entries: make(map[string]*requestCacheEntry)}
+}
+
+// GetVulnerabilities returns shared response for the same request or sends it with client.
+// Failed requests are not shared, so every container retries it.
+func (c *requestCache) GetVulnerabilities(ctx context.Context, rb *scanner.RequestBody) (*scanner.Vulnerabilities, error) {
+	return c.get(ctx, packagesKey(rb), func() (*scanner.Vulnerabilities, error) {
+		return c.client.GetVulnerabilities(ctx, rb)
+	})
+}
+
+// GetSoftwareVulnerabilities returns shared response for the same software version or sends it with software client
+func (c *requestCache) GetSoftwareVulnerabilities(ctx context.Context, name, version string) (*scanner.Vulnerabilities, error) {
+	return c.get(ctx, softwareKey(name, version), func() (*scanner.Vulnerabilities, error) {
+		return c.software.GetSoftwareVulnerabilities(ctx, name, version)
+	})
+}
+
+// get returns shared response for key or calls request and shares its response
+func (c *requestCache) get(ctx context.Context, key string, request func() (*scanner.Vulnerabilities, error)) (*scanner.Vulnerabilities, error) {
+	c.mu.Lock()
+	e, ok := c.entries[key]
+	if !ok {
+		e = &requestCacheEntry{ready: make(chan struct{})}
+		c.entries[key] = e
+		c.mu.Unlock()
+
+		e.vulns, e.err = request()
+		close(e.ready)
+		return copyVulnerabilities(e.vulns), e.err
+	}
+	c.mu.Unlock()
+
+	<-e.ready
+	if e.err != nil {
+		return request()
+	}
+	debugf("Container %s shares Vulners response with another container", scanner.ContainerIDFromContext(ctx))
+	return copyVulnerabilities(e.vulns), nil
+}
+
+// packagesKey returns key of request that is the same for requests with the same OS, version and packages
+func packagesKey(rb *scanner.RequestBody) string {
+	pkgs := append([]string(nil), rb.Package...)
+	sort.Strings(pkgs)
+	return rb.Os + "\x00" + rb.Version + "\x00" + strings.Join(pkgs, "\n")
+}
+
+// softwareKey returns key of software request, it can't match packagesKey since package list has no zero bytes
+func softwareKey(name, version string) string {
+	return "software\x00" + name + "\x00" + version + "\x00"
+}
+
+// diskCache keeps Vulners responses in files between runs, so identical package sets,
+// e.g. of nightly scanned images, aren't sent again until ttl expires
+type diskCache struct {
+	client   scanner.Client
+	software scanner.SoftwareClient
+	dir      string
+	ttl      time.Duration
+	// scope separates responses of different Vulners APIs, e.g. on-premise instance
+	scope string
+}
+
+func newDiskCache(client scanner.Client, software scanner.SoftwareClient, dir string, ttl time.Duration, scope string) (*diskCache, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &diskCache{client: client, software: software, dir: dir, ttl: ttl, scope: scope}, nil
+}
+
+// path returns file of cached response for key of request, name is hash of API and key
+func (c *diskCache) path(key string) string {
+	sum := sha256.Sum256([]byte(c.scope + "\x00" + key))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+// GetVulnerabilities returns cached response if it's younger than ttl or sends request with client
+// and caches response. Failures to read or write cache are logged and request is sent as usual.
+func (c *diskCache) GetVulnerabilities(ctx context.Context, rb *scanner.RequestBody) (*scanner.Vulnerabilities, error) {
+	return c.get(ctx, packagesKey(rb), func() (*scanner.Vulnerabilities, error) {
+		return c.client.GetVulnerabilities(ctx, rb)
+	})
+}
+
+// GetSoftwareVulnerabilities returns cached response of software API like GetVulnerabilities
+func (c *diskCache) GetSoftwareVulnerabilities(ctx context.Context, name, version string) (*scanner.Vulnerabilities, error) {
+	return c.get(ctx, softwareKey(name, version), func() (*scanner.Vulnerabilities, error) {
+		return c.software.GetSoftwareVulnerabilities(ctx, name, version)
+	})
+}
+
+// get returns cached response for key or calls request and caches its response
+func (c *diskCache) get(ctx context.Context, key string, request func() (*scanner.Vulnerabilities, error)) (*scanner.Vulnerabilities, error) {
+	path := c.path(key)
+	if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) < c.ttl {
+		data, err := ioutil.ReadFile(path)
+		if err == nil {
+			var vulns scanner.Vulnerabilities
+			if err = json.Unmarshal(data, &vulns); err == nil {
+				debugf("Using cached Vulners response %s for container %s", path, scanner.ContainerIDFromContext(ctx))
+				return &vulns, nil
+			}
+		}
+		warnf("Failed to read cached Vulners response %s: %v", path, err)
+	}
+
+	vulns, err := request()
+	if err != nil {
+		return nil, err
+	}
+	if err := c.write(path, vulns); err != nil {
+		warnf("Failed to cache Vulners response: %v", err)
+	}
+	return vulns, nil
+}
+
+// write saves response to temporary file and renames it, so concurrent runs don't read partial files
+func (c *diskCache) write(path string, vulns *scanner.Vulnerabilities) error {
+	data, err := json.Marshal(vulns)
+	if err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(c.dir, "tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// copyVulnerabilities returns deep copy of v, so scanner can filter and output can sort it
+// without changing shared value
+func copyVulnerabilities(v *scanner.Vulnerabilities) *scanner.Vulnerabilities {
+	if v == nil {
+		return nil
+	}
+	res := *v
+	res.CVE = copyStrings(v.CVE)
+	res.Bulletins = copyStrings(v.Bulletins)
+	res.SuppressedPackages = copyStrings(v.SuppressedPackages)
+	res.Reasons = copyReasons(v.Reasons)
+	res.Unfixable = copyReasons(v.Unfixable)
+	return &res
+}
+
+// copyStrings returns copy of s that keeps nil and empty slices as is
+func copyStrings(s []string) []string {
+	if s == nil {
+		return nil
+	}
+	return append(make([]string, 0, len(s)), s...)
+}
+
+func copyReasons(s []scanner.Reason) []scanner.Reason {
+	if s == nil {
+		return nil
+	}
+	res := make([]scanner.Reason, len(s))
+	for i, r := range s {
+		r.Cvelist = copyStrings(r.Cvelist)
+		res[i] = r
+	}
+	return res
+}
@@ -0,0 +1,30 @@
+package main
+
+import "os"
+
+// colorOutput enables ANSI colors in text output, it's set if output is terminal
+var colorOutput bool
+
+const colorReset = "\x1b[0m"
+
+// severityColors contains ANSI colors of severities, low severity isn't colored
+var severityColors = map[string]string{
+	"critical": "\x1b[31m",
+	"high":     "\x1b[38;5;208m",
+	"medium":   "\x1b[33m",
+}
+
+// colorize returns text in color of severity of CVSS score if colors are enabled
+func colorize(score float64, text string) string {
+	c, ok := severityColors[severityFromScore(score)]
+	if !colorOutput || !ok {
+		return text
+	}
+	return c + text + colorReset
+}
+
+// isTerminal checks if file is character device, i.e. colors aren't written to files and pipes
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
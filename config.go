@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// configIgnoreKey is key of config file with list of CVE or bulletin IDs that shouldn't be reported
+const configIgnoreKey = "ignore"
+
+// config contains values from config file, keys are names of flags without leading dash
+type config map[string][]string
+
+// loadConfig reads JSON config file if it has .json extension or YAML config file otherwise
+func loadConfig(path string) (config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg config
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		cfg, err = parseJSONConfig(data)
+	} else {
+		cfg, err = parseYAMLConfig(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can't parse config file %s: %v", path, err)
+	}
+
+	var unknown []string
+	for key := range cfg {
+		if key == configIgnoreKey {
+			continue
+		}
+		if f := flag.Lookup(key); f == nil || key == "config" {
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("unknown keys in config file %s: %s", path, strings.Join(unknown, ", "))
+	}
+	return cfg, nil
+}
+
+// parseJSONConfig parses JSON object with strings, numbers, booleans or lists of them as values
+func parseJSONConfig(data []byte) (config, error) {
+	var raw map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&raw); err != nil {
+		return nil, err
+	}
+
+	cfg := make(config)
+	for key, value := range raw {
+		values, ok := value.([]interface{})
+		if !ok {
+			values = []interface{}{value}
+		}
+		for _, v := range values {
+			switch v := v.(type) {
+			case string:
+				cfg[key] = append(cfg[key], v)
+			case json.Number:
+				cfg[key] = append(cfg[key], v.String())
+			case bool:
+				cfg[key] = append(cfg[key], strconv.FormatBool(v))
+			default:
+				return nil, fmt.Errorf("unsupported value of key %s", key)
+			}
+		}
+	}
+	return cfg, nil
+}
+
+// parseYAMLConfig parses subset of YAML with "key: value" lines, lists are written
+// as "key: [a, b]" or as "- value" lines after "key:", # starts a comment
+func parseYAMLConfig(data []byte) (config, error) {
+	cfg := make(config)
+	var list string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if i := strings.Index(line, " #"); i > -1 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || line == "---" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "- ") {
+			if list == "" {
+				return nil, fmt.Errorf("line %d: list item without key", n)
+			}
+			cfg[list] = append(cfg[list], unquote(strings.TrimSpace(line[2:])))
+			continue
+		}
+
+		i := strings.Index(line, ":")
+		if i < 1 {
+			return nil, fmt.Errorf("line %d: expected \"key: value\"", n)
+		}
+		key, value := strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:])
+		list = ""
+		switch {
+		case value == "":
+			list = key
+			cfg[key] = nil
+		case strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]"):
+			for _, v := range strings.Split(value[1:len(value)-1], ",") {
+				if v = strings.TrimSpace(v); v != "" {
+					cfg[key] = append(cfg[key], unquote(v))
+				}
+			}
+		default:
+			cfg[key] = []string{unquote(value)}
+		}
+	}
+	return cfg, scanner.Err()
+}
+
+func unquote(s string) string {
+	if len(s) > 1 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// apply sets flags that weren't set in command line to values from config
+func (c config) apply() error {
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	for key, values := range c {
+		if key == configIgnoreKey || set[key] {
+			continue
+		}
+		for _, v := range values {
+			if err := flag.Set(key, v); err != nil {
+				return fmt.Errorf("invalid value %q of %s in config file: %v", v, key, err)
+			}
+		}
+	}
+	return nil
+}
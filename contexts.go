@@ -0,0 +1,75 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/artemnikitin/vulnedock/scanner"
+)
+
+// dockerContextMeta is content of meta.json of Docker CLI context
+type dockerContextMeta struct {
+	Name      string `json:"Name"`
+	Endpoints map[string]struct {
+		Host string `json:"Host"`
+	} `json:"Endpoints"`
+}
+
+// dockerConfigDir returns directory with Docker CLI configuration, DOCKER_CONFIG or ~/.docker
+func dockerConfigDir() (string, error) {
+	if dir := os.Getenv("DOCKER_CONFIG"); dir != "" {
+		return dir, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".docker"), nil
+}
+
+// newContextClient creates Docker client for Docker CLI context. Context is stored in
+// contexts/meta/<sha256 of name>/meta.json and its TLS files in contexts/tls/<sha256 of name>/docker.
+// Context "default" uses -host and Docker environment variables.
+func newContextClient(name string) (scanner.DockerClient, error) {
+	if name == "default" {
+		return newDockerClient(*dockerHost, *tlsCA, *tlsCert, *tlsKey)
+	}
+
+	dir, err := dockerConfigDir()
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256([]byte(name))
+	id := hex.EncodeToString(sum[:])
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "contexts", "meta", id, "meta.json"))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("Docker context %q doesn't exist", name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var meta dockerContextMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, fmt.Errorf("can't read Docker context %q: %v", name, err)
+	}
+	host := meta.Endpoints["docker"].Host
+	if host == "" {
+		return nil, fmt.Errorf("Docker context %q doesn't have Docker endpoint", name)
+	}
+
+	tlsDir := filepath.Join(dir, "contexts", "tls", id, "docker")
+	tlsFile := func(file string) string {
+		path := filepath.Join(tlsDir, file)
+		if _, err := os.Stat(path); err != nil {
+			return ""
+		}
+		return path
+	}
+	return newDockerClient(host, tlsFile("ca.pem"), tlsFile("cert.pem"), tlsFile("key.pem"))
+}
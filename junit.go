@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/artemnikitin/vulnedock/scanner"
+)
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// junitName returns name of test case for container, first name of container is used if it's known
+func junitName(res *scanner.ContainerResult) string {
+	if len(res.Names) > 0 {
+		return res.Names[0]
+	}
+	return res.ID
+}
+
+// printJUnit writes results as JUnit XML report, every container is a test case
+// and vulnerable container is a failed test case with list of CVE in failure
+func printJUnit(w io.Writer, results []*scanner.ContainerResult) error {
+	suite := junitTestSuite{Name: "vulnedock", TestCases: []junitTestCase{}}
+	for _, res := range results {
+		tc := junitTestCase{Name: junitName(res), ClassName: res.Image}
+		if res.Request == nil && res.Count() > 0 {
+			var text []string
+			for _, f := range res.Findings {
+				if len(f.Packages) > 0 {
+					text = append(text, fmt.Sprintf("%s (%s)", f.CVE, strings.Join(f.Packages, ", ")))
+				} else {
+					text = append(text, f.CVE)
+				}
+			}
+			for _, r := range res.Reasons {
+				text = append(text, r.String())
+			}
+			cves := len(res.CVE)
+			for _, lang := range res.Languages {
+				cves += len(lang.CVE)
+				for _, f := range lang.GroupByCVE() {
+					text = append(text, fmt.Sprintf("%s (%s: %s)", f.CVE, lang.Ecosystem, strings.Join(f.Packages, ", ")))
+				}
+			}
+			tc.Failure = &junitFailure{
+				Message: fmt.Sprintf("%d CVE found in container %s (%s %s), CVSS %.1f", cves, res.ID, res.OS, res.Version, res.MaxCvss()),
+				Type:    severityFromScore(res.MaxCvss()),
+				Text:    strings.Join(text, "\n"),
+			}
+			suite.Failures++
+		}
+		suite.TestCases = append(suite.TestCases, tc)
+	}
+	suite.Tests = len(suite.TestCases)
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(junitTestSuites{Tests: suite.Tests, Failures: suite.Failures, Suites: []junitTestSuite{suite}}); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+const (
+	levelDebug = iota
+	levelInfo
+	levelWarn
+	levelError
+)
+
+var levelNames = map[string]int{
+	"debug": levelDebug,
+	"info":  levelInfo,
+	"warn":  levelWarn,
+	"error": levelError,
+}
+
+// logLevel is minimal level of messages written to log, it's set in main from -log-level
+var logLevel = levelInfo
+
+func setLogLevel(name string) error {
+	level, ok := levelNames[strings.ToLower(name)]
+	if !ok {
+		return fmt.Errorf("unknown log level %q, should be one of debug, info, warn or error", name)
+	}
+	logLevel = level
+	return nil
+}
+
+func logf(level int, prefix, format string, v ...interface{}) {
+	if level >= logLevel {
+		log.Output(3, prefix+fmt.Sprintf(format, v...))
+	}
+}
+
+func debugf(format string, v ...interface{}) {
+	logf(levelDebug, "DEBUG: ", format, v...)
+}
+
+func infof(format string, v ...interface{}) {
+	logf(levelInfo, "INFO: ", format, v...)
+}
+
+func warnf(format string, v ...interface{}) {
+	logf(levelWarn, "WARN: ", format, v...)
+}
+
+func errorf(format string, v ...interface{}) {
+	logf(levelError, "ERROR: ", format, v...)
+}
+
+// cliLogger passes messages from scanner to leveled log
+type cliLogger struct{}
+
+func (cliLogger) Debugf(format string, v ...interface{}) {
+	logf(levelDebug, "DEBUG: ", format, v...)
+}
+
+func (cliLogger) Infof(format string, v ...interface{}) {
+	logf(levelInfo, "INFO: ", format, v...)
+}
+
+func (cliLogger) Warnf(format string, v ...interface{}) {
+	logf(levelWarn, "WARN: ", format, v...)
+}
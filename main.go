@@ -1,243 +1,679 @@
 package main
 
 import (
-	"bytes"
+	"bufio"
 	"context"
-	"encoding/json"
+	"flag"
 	"fmt"
-	"io"
-	"io/ioutil"
 	"log"
 	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
 	"strings"
 	"time"
 
+	"github.com/artemnikitin/vulnedock/scanner"
 	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
 	"github.com/moby/moby/client"
+	"golang.org/x/time/rate"
 )
 
-const URL = "https://vulners.com/api/v3/audit/audit/"
+// version is set at build time with -ldflags "-X main.version=1.2.3"
+var version = "dev"
 
 var (
-	OSVersion      = []string{"cat", "/etc/os-release"}
-	UbuntuPackages = []string{"dpkg-query", "-W", "-f=${Package} ${Version} ${Architecture}\n"}
-	CentOSPackages = []string{"rpm", "-qa"}
-	AlpinePackages = []string{"apk", "-v", "info"}
-	UbuntuOS       = []string{"debian", "ubuntu", "kali"}
-	CentOS         = []string{"rhel", "centos", "oraclelinux", "suse", "fedora"}
-	AlpineOS       = []string{"alpine"}
+	scanAll          = flag.Bool("all", false, "scan all running containers, default if no -container is specified")
+	configFile       = flag.String("config", "", "YAML or JSON config file with flag values, keys are flag names, flags in command line override it")
+	includeStopped   = flag.Bool("include-stopped", false, "include stopped containers in the list of containers to scan")
+	containersFile   = flag.String("containers-from-file", "", "file with IDs or names of containers to scan, one per line, - reads stdin, containers aren't listed then")
+	composeProject   = flag.String("compose-project", "", "scan only containers of Docker Compose project, summary is grouped by Compose service")
+	swarmService     = flag.String("service", "", "scan only running task containers of Docker Swarm service on this node, tasks of the same image are scanned once")
+	dockerHost       = flag.String("host", "", "Docker daemon host, e.g. unix:///var/run/docker.sock or tcp://remote:2376, DOCKER_HOST is used if empty")
+	tlsCert          = flag.String("tls-cert", "", "path to TLS certificate file for Docker daemon")
+	tlsKey           = flag.String("tls-key", "", "path to TLS key file for Docker daemon")
+	tlsCA            = flag.String("tls-ca", "", "path to TLS CA certificate file for Docker daemon")
+	apiURL           = flag.String("api-url", "", "URL of Vulners audit API, VULNERS_URL is used if empty (default "+scanner.URL+")")
+	formatVersion    = flag.String("format-version", scanner.DefaultFormatVersion, "version of Vulners audit API, it's used in default URL and defines format of requests and responses")
+	apiKey           = flag.String("api-key", "", "Vulners API key, VULNERS_API_KEY is used if empty")
+	exitZero         = flag.Bool("exit-zero", false, "exit with code 0 even if vulnerabilities were found")
+	failOn           = flag.String("fail-on", "any", "exit with code 1 only if finding with severity at or above level is found: any, low, medium, high, critical or none")
+	debug            = flag.Bool("debug", false, "print debug messages, same as -log-level debug")
+	logLevelName     = flag.String("log-level", "info", "log level: debug, info, warn or error")
+	output           = flag.String("output", "text", "output format: text, json, jsonl, sarif, csv or junit")
+	sortBy           = flag.String("sort", "severity", "order of containers in results: severity for the highest CVSS score first or id")
+	csvClean         = flag.Bool("csv-include-clean", false, "write row with empty CVE for clean containers in csv output")
+	dryRun           = flag.Bool("dry-run", false, "detect OS and packages and print request to Vulners without sending it")
+	noNetwork        = flag.Bool("no-network", false, "never contact Vulners, packages are collected and requests are written to results like with -dry-run")
+	dbPath           = flag.String("db", "", "match Debian and Ubuntu packages against downloaded OVAL definitions file instead of Vulners API")
+	cacheDir         = flag.String("cache-dir", "", "directory to cache Vulners responses between runs, responses are reused for the same OS, version and packages")
+	cacheTTL         = flag.Duration("cache-ttl", 24*time.Hour, "time Vulners responses are reused from -cache-dir")
+	noCache          = flag.Bool("no-cache", false, "don't use -cache-dir, e.g. to override it in config file")
+	skipPreflight    = flag.Bool("skip-preflight", false, "don't check that Docker daemon and Vulners are reachable before the scan")
+	showPackages     = flag.Bool("show-packages", false, "log list of packages detected in every container before it's sent to Vulners")
+	ignoreFile       = flag.String("ignore-file", "", "file with CVE or bulletin IDs that shouldn't be reported, one per line, # starts a comment")
+	minCVSS          = flag.Float64("min-cvss", 0, "report only vulnerabilities with CVSS score at or above threshold")
+	since            = flag.String("since", "", "report only CVE published after date in format 2006-01-02, it's ignored with warning since Vulners audit API doesn't return publication dates")
+	onlyFixable      = flag.Bool("only-fixable", false, "report only vulnerabilities with fixed version newer than installed one, others are listed as unfixable")
+	proxy            = flag.String("proxy", "", "proxy URL for Vulners requests, HTTP_PROXY, HTTPS_PROXY and NO_PROXY are used if empty")
+	userAgent        = flag.String("user-agent", "", "User-Agent header of requests to Vulners, default is vulnedock/<version>")
+	apiCA            = flag.String("api-ca", "", "PEM file with CA certificates to verify Vulners API, e.g. for on-premise instance, system certificates are trusted too")
+	apiInsecure      = flag.Bool("api-insecure", false, "don't verify TLS certificate of Vulners API, insecure, use only for testing")
+	timeout          = flag.Duration("timeout", 5*time.Minute, "timeout for the whole scan, in watch mode it's applied to every scan")
+	containerTimeout = flag.Duration("timeout-per-container", 0, "timeout of scan of one container, timed out containers are skipped and the scan continues, 0 means no limit except -timeout")
+	httpTimeout      = flag.Duration("http-timeout", 30*time.Second, "timeout for every request to Vulners, it's independent from -timeout")
+	watch            = flag.Duration("watch", 0, "rescan containers with interval, only new vulnerabilities are reported")
+	watchFull        = flag.Bool("watch-full", false, "report all vulnerabilities on every scan in watch mode")
+	retries          = flag.Int("retries", 2, "number of retries for failed Vulners requests")
+	concurrency      = flag.Int("concurrency", 4, "number of containers scanned in parallel")
+	rps              = flag.Float64("rps", 0, "maximum number of requests to Vulners per second shared by all parallel scans, 0 means no limit")
+	packagesFile     = flag.String("packages-file", "", "check packages from file instead of containers, one package per line, Docker isn't used")
+	maxPackages      = flag.Int("max-packages", 0, "maximum number of packages in one request to Vulners, larger lists are split into several requests, 0 means no limit")
+	truncatePackages = flag.Bool("max-packages-truncate", false, "check only first -max-packages packages instead of splitting them into several requests")
+	osName           = flag.String("os", "", "OS ID as in /etc/os-release for packages from -packages-file, e.g. ubuntu")
+	osVersion        = flag.String("os-version", "", "OS version as in /etc/os-release for packages from -packages-file, e.g. 20.04")
+	image            = flag.String("image", "", "scan image instead of running containers, temporary container is created from image for the scan")
+	topCVE           = flag.Int("top", 10, "number of the most frequent CVE in summary")
+	metricsAddr      = flag.String("serve-metrics", "", "address to serve Prometheus metrics on, e.g. :9090, server works until the process is stopped")
+	quiet            = flag.Bool("quiet", false, "don't print progress of the scan")
+	noColor          = flag.Bool("no-color", false, "don't color text output by severity, colors are used only if output is terminal and NO_COLOR isn't set")
+	outputFile       = flag.String("output-file", "", "write results to file instead of stdout, existing file is overwritten")
+	requestLog       = flag.String("json-request-log", "", "write every request sent to Vulners as JSON line to file, API key is redacted")
+	skipUnsupported  = flag.Bool("skip-unsupported", false, "skip containers that can't be scanned, e.g. Windows containers, without counting them as failed")
+	gentoo           = flag.Bool("gentoo", false, "scan Gentoo containers, Vulners support for Gentoo is limited and results may be incomplete")
+	scanLang         = flag.Bool("scan-lang", false, "also check pip, npm and gem packages in containers with Vulners software API, one request is sent per package")
+	containers       stringList
+	dockerContexts   stringList
+	excluded         stringList
+	ignoredPackages  stringList
+	labelsNot        stringList
+	// fileContainers contains IDs or names read from -containers-from-file
+	fileContainers []string
+	imageFilters   stringList
+	// imagePatterns contains compiled -image-filter globs
+	imagePatterns []*regexp.Regexp
+	labels        stringList
 )
 
-// RequestBody describe JSON for request
-type RequestBody struct {
-	Os      string   `json:"os"`
-	Version string   `json:"version"`
-	Package []string `json:"package"`
-}
-
-// ResponseBody contains response from vulners.com
-type ResponseBody struct {
-	Result string `json:"result"`
-	Data   struct {
-		Error           string   `json:"error"`
-		ErrorCode       int      `json:"errorCode"`
-		Vulnerabilities []string `json:"vulnerabilities"`
-		Reasons         []struct {
-			Package         string `json:"package"`
-			ProvidedVersion string `json:"providedVersion"`
-			BulletinVersion string `json:"bulletinVersion"`
-			ProvidedPackage string `json:"providedPackage"`
-			BulletinPackage string `json:"bulletinPackage"`
-			Operator        string `json:"operator"`
-			BulletinID      string `json:"bulletinID"`
-		} `json:"reasons"`
-		Cvss struct {
-			Score  float64 `json:"score"`
-			Vector string  `json:"vector"`
-		} `json:"cvss"`
-		Cvelist []string `json:"cvelist"`
-		ID      string   `json:"id"`
-	} `json:"data"`
+// stringList is a flag value that can be specified multiple times
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringList) Set(value string) error {
+	*s = append(*s, value)
+	return nil
 }
 
 func main() {
+	flag.Var(&containers, "container", "ID or name of container to scan, can be repeated")
+	flag.Var(&labels, "label", "scan only containers with label, key or key=value, can be repeated")
+	flag.Var(&imageFilters, "image-filter", "scan only containers with image matching glob, e.g. myorg/* or *:latest, can be repeated")
+	flag.Var(&ignoredPackages, "ignore-package", "name of package which findings shouldn't be reported, e.g. patched out-of-band, can be repeated")
+	flag.Var(&labelsNot, "label-not", "don't scan containers with label, key or key=value, can be repeated, it takes precedence over -label")
+	flag.Var(&excluded, "exclude", "ID or name of container that shouldn't be scanned even with -all, can be repeated")
+	flag.Var(&dockerContexts, "context", "name of Docker CLI context to scan, can be repeated, results are tagged with context name")
+	flag.Parse()
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
-	ctx := context.Background()
-
-	cli, err := client.NewEnvClient()
+	var cfg config
+	if *configFile != "" {
+		var err error
+		if cfg, err = loadConfig(*configFile); err != nil {
+			log.Fatal(err)
+		}
+		if err := cfg.apply(); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *debug {
+		*logLevelName = "debug"
+	}
+	if err := setLogLevel(*logLevelName); err != nil {
+		log.Fatal(err)
+	}
+	switch *output {
+	case "text", "json", "jsonl", "sarif", "csv", "junit":
+	default:
+		log.Fatalf("Unknown output format %q", *output)
+	}
+	if _, ok := severityRanks[*failOn]; !ok && *failOn != "any" {
+		log.Fatalf("Unknown severity %q for -fail-on, should be any, low, medium, high, critical or none", *failOn)
+	}
+	if *sortBy != "severity" && *sortBy != "id" {
+		log.Fatalf("Unknown sort order %q, should be severity or id", *sortBy)
+	}
+	if *retries < 0 {
+		log.Fatal("Number of retries can't be negative")
+	}
+	if (*tlsCA != "" || *tlsCert != "" || *tlsKey != "") && *dockerHost == "" && os.Getenv("DOCKER_HOST") == "" {
+		log.Fatal("TLS files can be used only with remote Docker daemon set with -host or DOCKER_HOST")
+	}
+	if *concurrency < 1 {
+		log.Fatal("Concurrency should be at least 1")
+	}
+	if *rps < 0 {
+		log.Fatal("Requests per second can't be negative")
+	}
+	if *since != "" {
+		if _, err := time.Parse("2006-01-02", *since); err != nil {
+			log.Fatalf("Invalid date %q for -since, should be in format 2006-01-02", *since)
+		}
+		// Filtering would need a request per CVE to get its publication date
+		warnf("Vulners audit API doesn't return publication dates of CVE, -since is ignored and all CVE are reported")
+	}
+	if *containersFile != "" {
+		ids, err := readContainersFile(*containersFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fileContainers = ids
+	}
+	imagePatterns = compileImagePatterns(imageFilters)
+	if *cacheTTL <= 0 {
+		log.Fatal("Cache TTL should be positive")
+	}
+	if *maxPackages < 0 {
+		log.Fatal("Maximum number of packages can't be negative")
+	}
+	if *containerTimeout < 0 {
+		log.Fatal("Timeout per container can't be negative")
+	}
+	if *httpTimeout <= 0 {
+		log.Fatal("HTTP timeout should be positive")
+	}
+	if err := resolveAPIURL(); err != nil {
+		log.Fatal(err)
+	}
+	var ignored map[string]bool
+	if *ignoreFile != "" {
+		ids, err := loadIgnoreFile(*ignoreFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		ignored = ids
+	}
+	if ids := cfg[configIgnoreKey]; len(ids) > 0 {
+		if ignored == nil {
+			ignored = make(map[string]bool)
+		}
+		for _, id := range ids {
+			ignored[id] = true
+		}
+	}
+	if *apiKey == "" {
+		*apiKey = os.Getenv("VULNERS_API_KEY")
+	}
+	if *apiKey == "" && *dbPath == "" {
+		warnf("Vulners API key isn't set, requests are subject to rate limits for anonymous users")
+	}
+	if *scanLang && *dbPath != "" {
+		log.Fatal("Language packages can't be checked with offline database, -scan-lang can't be used with -db")
+	}
+	auditor, err := newAuditor()
 	if err != nil {
 		log.Fatal(err)
 	}
-
-	resp, err := cli.ContainerList(ctx, types.ContainerListOptions{})
+	var requestLogFile *os.File
+	if *requestLog != "" {
+		requestLogFile, err = createOutputFile(*requestLog)
+		if err != nil {
+			log.Fatal(err)
+		}
+		auditor.RequestLog = requestLogFile
+	}
+	client, software, err := newClient(auditor)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	for _, v := range resp {
-		getInfo(cli, ctx, v)
+	// Docker isn't used if packages are read from file, clients for contexts are created below
+	var docker scanner.DockerClient
+	if *packagesFile == "" && len(dockerContexts) == 0 {
+		cli, err := newDockerClient(*dockerHost, *tlsCA, *tlsCert, *tlsKey)
+		if err != nil {
+			log.Fatal(err)
+		}
+		docker = cli
+	} else if *packagesFile != "" && *osName == "" {
+		log.Fatal("OS should be set with -os if -packages-file is used")
 	}
-}
-
-func getInfo(cli *client.Client, ctx context.Context, container types.Container) {
-	fmt.Println("For container with ID:", container.ID)
-	osver := executeCmd(cli, ctx, container.ID, OSVersion)
 
-	var pkgs []string
-	if checkOS(osver, UbuntuOS) {
-		temp := executeCmd(cli, ctx, container.ID, UbuntuPackages)
-		pkgs = strings.Split(temp, "\r\n")
-	} else if checkOS(osver, CentOS) {
-		temp := executeCmd(cli, ctx, container.ID, CentOSPackages)
-		pkgs = strings.Split(temp, "\r\n")
-	} else if checkOS(osver, AlpineOS) {
-		temp := executeCmd(cli, ctx, container.ID, AlpinePackages)
-		temp2 := strings.Split(temp, "\r\n")
-		for _, v := range temp2 {
-			if !strings.Contains(v, "WARNING") {
-				pkgs = append(pkgs, v)
+	s := scanner.New(docker, client)
+	s.MinCVSS = *minCVSS
+	s.Ignored = ignored
+	if len(ignoredPackages) > 0 {
+		s.IgnoredPackages = make(map[string]bool)
+		for _, v := range ignoredPackages {
+			s.IgnoredPackages[v] = true
+		}
+	}
+	s.DryRun = *dryRun
+	s.ShowPackages = *showPackages
+	s.Gentoo = *gentoo
+	s.OnlyFixable = *onlyFixable
+	s.MaxPackages = *maxPackages
+	s.TruncatePackages = *truncatePackages
+	s.ScanLang = *scanLang
+	s.Software = software
+	s.Log = cliLogger{}
+
+	targets := []scanTarget{{Scanner: s}}
+	if *packagesFile == "" && len(dockerContexts) > 0 {
+		targets = nil
+		for _, name := range dockerContexts {
+			cli, err := newContextClient(name)
+			if err != nil {
+				log.Fatal(err)
 			}
+			t := *s
+			t.Docker = cli
+			targets = append(targets, scanTarget{Name: name, Scanner: &t})
 		}
-	} else {
-		log.Fatal("Can't determine type of OS or OS is not supported: ", osver)
 	}
 
-	name, ver := getOSNameAndVersion(osver)
-	fmt.Println("OS:", name+" "+ver)
-	body := &RequestBody{
-		Os:      name,
-		Version: ver,
-		Package: pkgs,
+	if !*skipPreflight {
+		if err := preflight(targets, auditor, !*dryRun && *dbPath == ""); err != nil {
+			log.Fatal(err)
+		}
 	}
-	_, err := getVulnerabilities(body)
-	if err != nil {
-		log.Fatal(err)
+
+	if *metricsAddr != "" {
+		if _, err := serveMetrics(*metricsAddr); err != nil {
+			log.Fatalf("Can't serve metrics: %v", err)
+		}
 	}
-}
 
-func checkOS(text string, options []string) bool {
-	var res bool
-	for _, v := range options {
-		if strings.Contains(strings.ToLower(text), v) {
-			res = true
-			break
+	out := os.Stdout
+	if *outputFile != "" {
+		out, err = createOutputFile(*outputFile)
+		if err != nil {
+			log.Fatal(err)
 		}
 	}
-	return res
-}
 
-func getOSNameAndVersion(text string) (string, string) {
-	var name string
-	var version string
+	colorOutput = *output == "text" && !*noColor && os.Getenv("NO_COLOR") == "" && isTerminal(out)
+	rep := newReporter(out)
+	if *watch > 0 {
+		watchScans(targets, rep, *watch)
+		if err := out.Close(); err != nil {
+			log.Fatal(err)
+		}
+		closeRequestLog(requestLogFile)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	run, err := runScans(ctx, targets, rep.Result)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	if i := strings.Index(text, "ID="); i > -1 {
-		name = assign(text[i+3:])
+	if err := rep.Report(run.Results, run); err != nil {
+		log.Fatal(err)
+	}
+	if *output != "text" {
+		infof("Scanned %d containers successfully, failed to scan %d containers, skipped %d unsupported containers, %d containers without exec permission and %d timed out containers", run.Scanned, run.Failed, run.Skipped, run.ExecDenied, run.TimedOut)
 	}
-	if i := strings.Index(text, "VERSION_ID="); i > -1 {
-		version = assign(text[i+11:])
+	if err := out.Close(); err != nil {
+		log.Fatal(err)
 	}
+	closeRequestLog(requestLogFile)
 
-	return name, version
-}
+	if *metricsAddr != "" {
+		infof("Scan is finished, serving metrics on %s", *metricsAddr)
+		select {}
+	}
 
-func assign(text string) string {
-	var res string
-	if string(text[0]) == "\"" {
-		i := strings.Index(text[1:], "\"")
-		res = text[1 : i+1]
-	} else {
-		i := strings.Index(text, "\r")
-		res = text[:i]
+	if code := exitCode(run, ctx.Err() == context.DeadlineExceeded); code != 0 {
+		os.Exit(code)
 	}
-	return res
 }
 
-func executeCmd(cli *client.Client, ctx context.Context, ID string, cmd []string) string {
-	params := types.ExecConfig{
-		AttachStderr: true,
-		AttachStdout: true,
-		Tty:          true,
-		Cmd:          cmd,
+// exitCode returns exit code of finished scan: 1 if scan timed out or a container has vulnerabilities
+// at -fail-on level, 2 if some containers or packages file failed to scan and 0 otherwise or with -exit-zero
+func exitCode(run *scanRun, timedOut bool) int {
+	if timedOut {
+		return 1
 	}
+	if *exitZero {
+		return 0
+	}
+	if res := failingResult(run.Results, *failOn); res != nil {
+		warnf("Failing because container %s has vulnerabilities with CVSS %.1f (%s), -fail-on is %s", res.ID, res.MaxCvss(), severityFromScore(res.MaxCvss()), *failOn)
+		return 1
+	}
+	if run.Failed > 0 {
+		warnf("Failing because %d containers failed to scan", run.Failed)
+		return 2
+	}
+	return 0
+}
 
-	resp, err := cli.ContainerExecCreate(ctx, ID, params)
+// newAuditor creates auditor for Vulners API configured with flags. Dry run is enabled by -no-network
+// unless packages are matched against offline database set with -db.
+func newAuditor() (*scanner.HTTPAuditor, error) {
+	auditor, err := scanner.NewHTTPAuditor(*apiURL, *apiKey, *proxy)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
+	}
+	if *apiCA != "" || *apiInsecure {
+		if *apiInsecure {
+			warnf("TLS certificate of Vulners API isn't verified, connection is open to man-in-the-middle attacks")
+		}
+		if err := auditor.SetTLS(*apiCA, *apiInsecure); err != nil {
+			return nil, err
+		}
+	}
+	auditor.UserAgent = *userAgent
+	if auditor.UserAgent == "" {
+		auditor.UserAgent = "vulnedock/" + version
 	}
+	auditor.Retries = *retries
+	auditor.HTTP.Timeout = *httpTimeout
+	if *rps > 0 {
+		auditor.Limiter = rate.NewLimiter(rate.Limit(*rps), 1)
+	}
+	if *noNetwork {
+		// Requests aren't sent in dry run, transport guarantees it for any code path
+		if *dbPath == "" {
+			*dryRun = true
+		}
+		auditor.HTTP = &http.Client{Transport: noNetworkTransport{}}
+	}
+	auditor.FormatVersion = *formatVersion
+	auditor.Log = cliLogger{}
+	return auditor, nil
+}
 
-	hijack, err := cli.ContainerExecAttach(ctx, resp.ID, params)
-	if err != nil {
-		log.Fatal(err)
+// newClient returns client that checks packages with auditor or offline database set with -db and client
+// of language packages, Vulners responses are cached on disk if -cache-dir is set
+func newClient(auditor *scanner.HTTPAuditor) (scanner.Client, scanner.SoftwareClient, error) {
+	if *dbPath != "" {
+		db, err := scanner.LoadOVAL(*dbPath)
+		if err != nil {
+			return nil, nil, err
+		}
+		return db, auditor, nil
+	}
+	vulners := scanner.NewClient(instrumentedAuditor{auditor})
+	vulners.Retries = *retries
+	vulners.Log = cliLogger{}
+	if *cacheDir != "" && !*noCache {
+		cache, err := newDiskCache(vulners, auditor, *cacheDir, *cacheTTL, *apiURL)
+		if err != nil {
+			return nil, nil, err
+		}
+		return cache, cache, nil
 	}
-	defer hijack.Close()
+	return vulners, auditor, nil
+}
 
-	buf := new(bytes.Buffer)
-	buf.ReadFrom(hijack.Reader)
-	return buf.String()
+// createOutputFile creates or truncates file for results together with its parent directories
+func createOutputFile(path string) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	return os.Create(path)
 }
 
-func getVulnerabilities(rb *RequestBody) ([]string, error) {
-	client := http.Client{
-		Timeout: 30 * time.Second,
+// noNetworkTransport fails every request, it's used with -no-network
+type noNetworkTransport struct{}
+
+func (noNetworkTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return nil, fmt.Errorf("request to %s is refused, network access is disabled with -no-network", req.URL.Host)
+}
+
+// closeRequestLog closes file set with -json-request-log if it's used
+func closeRequestLog(f *os.File) {
+	if f == nil {
+		return
+	}
+	if err := f.Close(); err != nil {
+		errorf("Failed to close request log: %v", err)
 	}
+}
 
-	data, err := json.Marshal(rb)
+// resolveAPIURL sets URL of Vulners API from flag, environment or default value and validates it
+func resolveAPIURL() error {
+	// Version is validated even if URL is set, since it defines format of requests
+	defaultURL, err := scanner.AuditURL(*formatVersion)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if *apiURL == "" {
+		*apiURL = os.Getenv("VULNERS_URL")
+	}
+	if *apiURL == "" {
+		*apiURL = defaultURL
 	}
 
-	req, err := http.NewRequest(http.MethodPost, URL, bytes.NewBuffer(data))
+	u, err := url.Parse(*apiURL)
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("invalid Vulners API URL %q: %v", *apiURL, err)
 	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid Vulners API URL %q: must be an absolute http or https URL", *apiURL)
+	}
+	return nil
+}
 
-	resp, err := client.Do(req)
+// newDockerClient creates client for provided host or from environment variables if host is empty
+func newDockerClient(host, ca, cert, key string) (*client.Client, error) {
+	// Client uses proxy from environment for TCP connections, so NO_PROXY is respected for Docker daemon too
+	if host == "" && os.Getenv("DOCKER_HOST") == "" {
+		if p := detectDockerSocket(); p != "" {
+			host = "unix://" + p
+		}
+	}
+	opts := []client.Opt{client.FromEnv}
+	if host != "" {
+		opts = []client.Opt{client.WithHost(host), client.WithVersion(os.Getenv("DOCKER_API_VERSION"))}
+	}
+	// TLS files override DOCKER_CERT_PATH if host is set with DOCKER_HOST
+	if ca != "" || cert != "" || key != "" {
+		opts = append(opts, client.WithTLSClientConfig(ca, cert, key))
+	}
+	opts = append(opts, client.WithAPIVersionNegotiation())
+	cli, err := client.NewClientWithOpts(opts...)
 	if err != nil {
 		return nil, err
 	}
-	defer func() {
-		io.Copy(ioutil.Discard, resp.Body)
-		resp.Body.Close()
-	}()
-
-	data, err = ioutil.ReadAll(resp.Body)
-	if err != nil {
+	infof("Using Docker daemon %s", cli.DaemonHost())
+	if err := negotiateDockerAPI(cli); err != nil {
 		return nil, err
 	}
+	return cli, nil
+}
 
-	body := &ResponseBody{}
-	err = json.Unmarshal(data, body)
+// negotiateDockerAPI picks API version supported by both client and Docker daemon, so daemons older
+// than client can be scanned. Version set with DOCKER_API_VERSION is used as is. Client negotiates
+// version itself on the first request, but errors are ignored then and requests fail with
+// "client version is too new" error.
+func negotiateDockerAPI(cli *client.Client) error {
+	if os.Getenv("DOCKER_API_VERSION") != "" {
+		debugf("Using Docker API version %s from DOCKER_API_VERSION", cli.ClientVersion())
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), preflightTimeout)
+	defer cancel()
+	ping, err := cli.Ping(ctx)
 	if err != nil {
-		return nil, err
+		if hint := socketPermissionHint(cli.DaemonHost(), err); hint != "" {
+			return fmt.Errorf("can't connect to Docker daemon, %s: %v", hint, err)
+		}
+		return fmt.Errorf("can't negotiate API version with Docker daemon %s, set DOCKER_API_VERSION to skip negotiation: %v", cli.DaemonHost(), err)
 	}
+	cli.NegotiateAPIVersionPing(ping)
+	debugf("Using Docker API version %s, daemon supports %s", cli.ClientVersion(), ping.APIVersion)
+	return nil
+}
 
-	return extractVulnerabilitiesFromResponse(body), nil
+// matchLabel returns the first of filters in form key or key=value that matches labels
+// or empty string if none of them matches
+func matchLabel(labels map[string]string, filters []string) string {
+	for _, f := range filters {
+		key, value := f, ""
+		hasValue := false
+		if i := strings.Index(f, "="); i > -1 {
+			key, value, hasValue = f[:i], f[i+1:], true
+		}
+		v, ok := labels[key]
+		if ok && (!hasValue || v == value) {
+			return f
+		}
+	}
+	return ""
 }
 
-func extractVulnerabilitiesFromResponse(body *ResponseBody) []string {
-	var result []string
+// containerFilters returns filters for containers selected with -label and -compose-project
+func containerFilters() filters.Args {
+	args := labelFilters(labels)
+	if *composeProject != "" {
+		args.Add("label", scanner.ComposeProjectLabel+"="+*composeProject)
+	}
+	if *swarmService != "" {
+		args.Add("label", scanner.SwarmServiceLabel+"="+*swarmService)
+	}
+	return args
+}
 
-	if body.Result != "OK" {
-		log.Println("Vulners err0r:", body.Data.Error)
-	} else {
-		if len(body.Data.Cvelist) > 0 || len(body.Data.Reasons) > 0 {
-			fmt.Println("Achtung! Vulnerabilities were found!")
-			if len(body.Data.Cvelist) > 0 {
-				fmt.Println("List of CVE:")
-				for _, v := range body.Data.Cvelist {
-					fmt.Println(v)
-				}
+// labelFilters returns filters for containers that have all provided labels
+func labelFilters(labels []string) filters.Args {
+	args := filters.NewArgs()
+	for _, l := range labels {
+		args.Add("label", l)
+	}
+	return args
+}
+
+// selectContainers returns containers that match provided IDs or names.
+// All containers are returned if all is set or no IDs or names provided.
+func selectContainers(list []types.Container, ids []string, all bool) ([]types.Container, error) {
+	if all || len(ids) == 0 {
+		return list, nil
+	}
+
+	var result []types.Container
+	for _, id := range ids {
+		found := false
+		for _, v := range list {
+			if matchContainer(v, id) {
+				result = append(result, v)
+				found = true
+				break
 			}
-			if len(body.Data.Reasons) > 0 {
-				fmt.Println("List of Bulletin ID:")
-				for _, v := range body.Data.Reasons {
-					fmt.Println(v.BulletinID)
-				}
+		}
+		if !found {
+			return nil, fmt.Errorf("no container with ID or name %q", id)
+		}
+	}
+	return result, nil
+}
+
+// matchImage checks if image matches any of patterns compiled by compileImagePatterns.
+// Any image matches if there are no patterns.
+func matchImage(image string, patterns []*regexp.Regexp) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, p := range patterns {
+		if p.MatchString(image) {
+			return true
+		}
+	}
+	return false
+}
+
+// compileImagePatterns converts glob patterns to regular expressions, * matches any characters
+// including / and ? matches one character
+func compileImagePatterns(patterns []string) []*regexp.Regexp {
+	var result []*regexp.Regexp
+	for _, p := range patterns {
+		var expr strings.Builder
+		expr.WriteString("^")
+		for _, r := range p {
+			switch r {
+			case '*':
+				expr.WriteString(".*")
+			case '?':
+				expr.WriteString(".")
+			default:
+				expr.WriteString(regexp.QuoteMeta(string(r)))
 			}
-		} else {
-			fmt.Println("Container is clean, congratulations!")
 		}
+		expr.WriteString("$")
+		result = append(result, regexp.MustCompile(expr.String()))
+	}
+	return result
+}
+
+// readContainersFile reads container IDs or names from file or stdin if path is "-",
+// one per line, empty lines and lines starting with # are skipped
+func readContainersFile(path string) ([]string, error) {
+	f := os.Stdin
+	if path != "-" {
+		var err error
+		if f, err = os.Open(path); err != nil {
+			return nil, err
+		}
+		defer f.Close()
 	}
 
+	var result []string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			result = append(result, line)
+		}
+	}
+	return result, s.Err()
+}
+
+// excludeContainers returns containers that don't match any of provided IDs or names
+func excludeContainers(list []types.Container, ids []string) []types.Container {
+	if len(ids) == 0 {
+		return list
+	}
+
+	matched := make(map[string]bool)
+	var result []types.Container
+	for _, v := range list {
+		exclude := false
+		for _, id := range ids {
+			if matchContainer(v, id) {
+				matched[id] = true
+				exclude = true
+			}
+		}
+		if exclude {
+			infof("Excluding container %s (%s)", v.ID, strings.Join(scanner.ContainerNames(v), ", "))
+			continue
+		}
+		result = append(result, v)
+	}
+	for _, id := range ids {
+		if !matched[id] {
+			warnf("No container with ID or name %q to exclude", id)
+		}
+	}
 	return result
 }
+
+func matchContainer(container types.Container, id string) bool {
+	if id != "" && strings.HasPrefix(container.ID, id) {
+		return true
+	}
+	for _, name := range container.Names {
+		if strings.TrimPrefix(name, "/") == strings.TrimPrefix(id, "/") {
+			return true
+		}
+	}
+	return false
+}
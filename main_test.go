@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/artemnikitin/vulnedock/scanner"
+)
+
+func TestExitCode(t *testing.T) {
+	vulnerable := &scanner.ContainerResult{ID: "c1", Vulnerabilities: scanner.Vulnerabilities{CVE: []string{"CVE-2021-3711"}, Cvss: 9.8}}
+	clean := &scanner.ContainerResult{ID: "c2"}
+	langVulnerable := &scanner.ContainerResult{ID: "c3", Languages: []scanner.LangResult{
+		{Ecosystem: "pip", Vulnerabilities: scanner.Vulnerabilities{CVE: []string{"CVE-2023-32681"}, Cvss: 6.1}},
+	}}
+	tests := []struct {
+		name     string
+		run      *scanRun
+		timedOut bool
+		exitZero bool
+		want     int
+	}{
+		{"clean", &scanRun{Results: []*scanner.ContainerResult{clean}, Scanned: 1}, false, false, 0},
+		{"vulnerable", &scanRun{Results: []*scanner.ContainerResult{vulnerable}, Scanned: 1}, false, false, 1},
+		{"vulnerable language packages", &scanRun{Results: []*scanner.ContainerResult{langVulnerable}, Scanned: 1}, false, false, 1},
+		{"all failed", &scanRun{Failed: 3}, false, false, 2},
+		{"some failed", &scanRun{Results: []*scanner.ContainerResult{clean}, Scanned: 1, Failed: 1}, false, false, 2},
+		{"all failed with -exit-zero", &scanRun{Failed: 3}, false, true, 0},
+		{"timed out", &scanRun{Failed: 1}, true, true, 1},
+	}
+	defer func(v bool, level string) { *exitZero, *failOn = v, level }(*exitZero, *failOn)
+	*failOn = "any"
+	for _, tt := range tests {
+		*exitZero = tt.exitZero
+		if got := exitCode(tt.run, tt.timedOut); got != tt.want {
+			t.Errorf("%s: exitCode() = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNoNetworkWithDB(t *testing.T) {
+	defer func(network, dry bool, db string) { *noNetwork, *dryRun, *dbPath = network, dry, db }(*noNetwork, *dryRun, *dbPath)
+	*noNetwork, *dryRun, *dbPath = true, false, filepath.Join("testdata", "oval-bullseye.xml")
+
+	auditor, err := newAuditor()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *dryRun {
+		t.Fatal("-no-network shouldn't enable dry run if -db is set")
+	}
+	client, _, err := newClient(auditor)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := scanner.New(nil, client)
+	s.DryRun = *dryRun
+	pkgs := []string{"openssl 1.1.1k-1+deb11u1 amd64", "bash 5.1-2+deb11u1 amd64"}
+	res, err := s.CheckPackages(context.Background(), &scanner.ContainerResult{ID: "c1", OS: "debian", Version: "11"}, pkgs)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if res.Request != nil || !reflect.DeepEqual(res.CVE, []string{"CVE-2022-0778"}) {
+		t.Errorf("result = %+v, want CVE-2022-0778 found offline", res)
+	}
+
+	*dbPath = ""
+	if _, err := newAuditor(); err != nil {
+		t.Fatal(err)
+	}
+	if !*dryRun {
+		t.Error("-no-network should enable dry run without -db")
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/artemnikitin/vulnedock/scanner"
+)
+
+// scanMetrics collects metrics exposed with -serve-metrics
+var scanMetrics = newMetrics()
+
+type vulnerabilityKey struct {
+	container string
+	severity  string
+}
+
+// metrics contains values of metrics and writes them in Prometheus text format
+type metrics struct {
+	mu               sync.Mutex
+	vulnerabilities  map[vulnerabilityKey]int
+	scanDuration     map[string]float64
+	vulnersRequests  int
+	vulnersDurations float64
+	// scanned contains containers seen since startRun, metrics of other containers are removed by finishRun
+	scanned map[string]bool
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		vulnerabilities: make(map[vulnerabilityKey]int),
+		scanDuration:    make(map[string]float64),
+	}
+}
+
+// setVulnerabilities sets number of vulnerabilities found in container. Vulners returns one aggregated
+// CVSS score, so all vulnerabilities of OS packages have the same severity and language packages have own ones.
+func (m *metrics) setVulnerabilities(res *scanner.ContainerResult) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.markScanned(res.ID)
+	for k := range m.vulnerabilities {
+		if k.container == res.ID {
+			delete(m.vulnerabilities, k)
+		}
+	}
+	m.vulnerabilities[vulnerabilityKey{container: res.ID, severity: severityFromScore(res.Cvss)}] = res.Vulnerabilities.Count()
+	for _, lang := range res.Languages {
+		if lang.Count() > 0 {
+			m.vulnerabilities[vulnerabilityKey{container: res.ID, severity: severityFromScore(lang.Cvss)}] += lang.Count()
+		}
+	}
+}
+
+func (m *metrics) observeScan(container string, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.markScanned(container)
+	m.scanDuration[container] = d.Seconds()
+}
+
+// startRun starts tracking of containers scanned by the run
+func (m *metrics) startRun() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.scanned = make(map[string]bool)
+}
+
+// finishRun removes metrics of containers that weren't scanned since startRun, e.g. removed ones,
+// so gauges don't keep values of containers that don't exist anymore
+func (m *metrics) finishRun() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.scanned == nil {
+		return
+	}
+	for k := range m.vulnerabilities {
+		if !m.scanned[k.container] {
+			delete(m.vulnerabilities, k)
+		}
+	}
+	for container := range m.scanDuration {
+		if !m.scanned[container] {
+			delete(m.scanDuration, container)
+		}
+	}
+	m.scanned = nil
+}
+
+// markScanned records container as scanned by current run, m.mu must be held
+func (m *metrics) markScanned(container string) {
+	if m.scanned != nil {
+		m.scanned[container] = true
+	}
+}
+
+func (m *metrics) observeVulnersRequest(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.vulnersRequests++
+	m.vulnersDurations += d.Seconds()
+}
+
+func (m *metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	var lines []string
+	for k, v := range m.vulnerabilities {
+		lines = append(lines, fmt.Sprintf("vulnedock_vulnerabilities_total{container=%q,severity=%q} %d", k.container, k.severity, v))
+	}
+	sort.Strings(lines)
+	fmt.Fprintln(w, "# HELP vulnedock_vulnerabilities_total Number of vulnerabilities found in container by last scan.")
+	fmt.Fprintln(w, "# TYPE vulnedock_vulnerabilities_total gauge")
+	for _, l := range lines {
+		fmt.Fprintln(w, l)
+	}
+
+	lines = lines[:0]
+	for k, v := range m.scanDuration {
+		lines = append(lines, fmt.Sprintf("vulnedock_scan_duration_seconds{container=%q} %g", k, v))
+	}
+	sort.Strings(lines)
+	fmt.Fprintln(w, "# HELP vulnedock_scan_duration_seconds Duration of last scan of container.")
+	fmt.Fprintln(w, "# TYPE vulnedock_scan_duration_seconds gauge")
+	for _, l := range lines {
+		fmt.Fprintln(w, l)
+	}
+
+	fmt.Fprintln(w, "# HELP vulnedock_vulners_request_duration_seconds Duration of requests to Vulners.")
+	fmt.Fprintln(w, "# TYPE vulnedock_vulners_request_duration_seconds summary")
+	fmt.Fprintf(w, "vulnedock_vulners_request_duration_seconds_sum %g\n", m.vulnersDurations)
+	fmt.Fprintf(w, "vulnedock_vulners_request_duration_seconds_count %d\n", m.vulnersRequests)
+}
+
+// instrumentedAuditor records duration of requests to Vulners in metrics
+type instrumentedAuditor struct {
+	scanner.Auditor
+}
+
+func (a instrumentedAuditor) Audit(ctx context.Context, rb *scanner.RequestBody) (*scanner.ResponseBody, error) {
+	start := time.Now()
+	defer func() {
+		scanMetrics.observeVulnersRequest(time.Since(start))
+	}()
+	return a.Auditor.Audit(ctx, rb)
+}
+
+// serveMetrics starts HTTP server with /metrics endpoint. Address is bound before return,
+// so error is returned if it's in use, and vulnedock exits if server fails later.
+func serveMetrics(addr string) (*http.Server, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", scanMetrics)
+	srv := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Metrics server failed: %v", err)
+		}
+	}()
+	return srv, nil
+}
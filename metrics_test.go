@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/artemnikitin/vulnedock/scanner"
+)
+
+func TestServeMetricsAddressInUse(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	if _, err := serveMetrics(ln.Addr().String()); err == nil {
+		t.Error("expected error for address in use")
+	}
+}
+
+func TestFinishRunRemovesVanishedContainers(t *testing.T) {
+	m := newMetrics()
+	vulnerable := &scanner.ContainerResult{ID: "c1", Vulnerabilities: scanner.Vulnerabilities{CVE: []string{"CVE-2021-3711"}, Cvss: 9.8}}
+	m.startRun()
+	m.observeScan("c1", time.Second)
+	m.setVulnerabilities(vulnerable)
+	m.observeScan("c2", time.Second)
+	m.setVulnerabilities(&scanner.ContainerResult{ID: "c2"})
+	m.finishRun()
+
+	m.startRun()
+	m.observeScan("c2", time.Second)
+	m.setVulnerabilities(&scanner.ContainerResult{ID: "c2"})
+	m.finishRun()
+
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	out := w.Body.String()
+	if strings.Contains(out, `container="c1"`) {
+		t.Errorf("metrics contain container removed before the last run:\n%s", out)
+	}
+	if !strings.Contains(out, `vulnedock_scan_duration_seconds{container="c2"}`) {
+		t.Errorf("metrics don't contain scanned container:\n%s", out)
+	}
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/artemnikitin/vulnedock/scanner"
+)
+
+// sortResults sorts results by CVSS score descending or by container ID if by is "id",
+// results with equal scores are sorted by container ID for stable output
+func sortResults(results []*scanner.ContainerResult, by string) {
+	sort.SliceStable(results, func(i, j int) bool {
+		if by != "id" && results[i].MaxCvss() != results[j].MaxCvss() {
+			return results[i].MaxCvss() > results[j].MaxCvss()
+		}
+		return results[i].ID < results[j].ID
+	})
+}
+
+// sortFindings sorts CVE and reasons of container by ID. Vulners returns one aggregated
+// CVSS score for container, so all its findings have the same score.
+func sortFindings(res *scanner.ContainerResult) {
+	sort.Strings(res.CVE)
+	sort.Strings(res.Bulletins)
+	sort.SliceStable(res.Reasons, func(i, j int) bool {
+		if res.Reasons[i].BulletinID != res.Reasons[j].BulletinID {
+			return res.Reasons[i].BulletinID < res.Reasons[j].BulletinID
+		}
+		return res.Reasons[i].Package < res.Reasons[j].Package
+	})
+	// Findings were grouped by scanner before CVE were sorted
+	res.Findings = res.GroupByCVE()
+}
+
+func printText(w io.Writer, res *scanner.ContainerResult) {
+	printContainerText(w, res)
+	printLangText(w, res)
+}
+
+// printLangText writes vulnerabilities of language packages of container per ecosystem
+func printLangText(w io.Writer, res *scanner.ContainerResult) {
+	for _, lang := range res.Languages {
+		fmt.Fprintf(w, "Packages of %s (%d):\n", lang.Ecosystem, lang.PackageCount)
+		if res.Request != nil {
+			continue
+		}
+		if lang.Count() == 0 {
+			fmt.Fprintln(w, "No vulnerabilities were found")
+			continue
+		}
+		fmt.Fprintln(w, colorize(lang.Cvss, fmt.Sprintf("CVSS: %.1f (%s)", lang.Cvss, severityLabel(lang.Cvss))))
+		for _, v := range lang.GroupByCVE() {
+			fmt.Fprintf(w, "%s (%s)\n", colorize(lang.Cvss, v.CVE), strings.Join(v.Packages, ", "))
+		}
+		for _, v := range lang.Reasons {
+			if len(v.Cvelist) == 0 {
+				fmt.Fprintf(w, "%s %s (bulletin %s)\n", v.Package, v.ProvidedVersion, v.BulletinID)
+			}
+		}
+	}
+}
+
+// printContainerText writes container and vulnerabilities of its OS packages
+func printContainerText(w io.Writer, res *scanner.ContainerResult) {
+	fmt.Fprintln(w, "For container with ID:", res.ID)
+	if len(res.Names) > 0 {
+		fmt.Fprintln(w, "Name:", strings.Join(res.Names, ", "))
+	}
+	fmt.Fprintln(w, "Image:", res.Image)
+	if res.Service != "" {
+		fmt.Fprintln(w, "Service:", res.Service)
+	}
+	if res.Context != "" {
+		fmt.Fprintln(w, "Docker context:", res.Context)
+	}
+	if res.PrettyName != "" {
+		fmt.Fprintln(w, "OS:", res.PrettyName)
+	} else {
+		fmt.Fprintln(w, "OS:", res.OS+" "+res.Version)
+	}
+	if res.Request != nil {
+		requests := res.RequestChunks
+		if len(requests) == 0 {
+			requests = []*scanner.RequestBody{res.Request}
+		}
+		for i, request := range requests {
+			data, err := json.MarshalIndent(request, "", "  ")
+			if err != nil {
+				return
+			}
+			if len(requests) > 1 {
+				fmt.Fprintf(w, "Request %d of %d to Vulners that would be sent:\n", i+1, len(requests))
+			} else {
+				fmt.Fprintln(w, "Request to Vulners that would be sent:")
+			}
+			fmt.Fprintln(w, string(data))
+		}
+		return
+	}
+	if res.Ignored > 0 {
+		fmt.Fprintf(w, "Ignored %d findings\n", res.Ignored)
+	}
+	if len(res.SuppressedPackages) > 0 {
+		fmt.Fprintln(w, "Suppressed findings of ignored packages:", strings.Join(res.SuppressedPackages, ", "))
+	}
+	if res.Vulnerabilities.Count() == 0 {
+		if len(res.Unfixable) > 0 {
+			fmt.Fprintln(w, "No vulnerabilities with available fix were found")
+			printUnfixable(w, res)
+			return
+		}
+		// OS and number of packages show that scan actually checked something
+		matched := strings.TrimSpace(res.OS + " " + res.Version)
+		if res.Count() > 0 {
+			fmt.Fprintf(w, "No vulnerabilities were found in OS packages: %s, %d packages checked\n", matched, res.PackageCount)
+		} else if *minCVSS > 0 {
+			fmt.Fprintf(w, "Container is clean above CVSS threshold %.1f: %s, %d packages checked\n", *minCVSS, matched, res.PackageCount)
+		} else {
+			fmt.Fprintf(w, "Container is clean: %s, %d packages checked\n", matched, res.PackageCount)
+		}
+		return
+	}
+
+	fmt.Fprintln(w, "Achtung! Vulnerabilities were found!")
+	// Vulners returns one score for container, so all CVE have its color
+	if res.CvssVector != "" {
+		fmt.Fprintln(w, colorize(res.Cvss, fmt.Sprintf("CVSS: %.1f (%s), vector: %s", res.Cvss, severityLabel(res.Cvss), res.CvssVector)))
+	} else {
+		fmt.Fprintln(w, colorize(res.Cvss, fmt.Sprintf("CVSS: %.1f (%s)", res.Cvss, severityLabel(res.Cvss))))
+	}
+	if len(res.CVE) > 0 {
+		fmt.Fprintln(w, "List of CVE:")
+		for _, v := range res.Findings {
+			if len(v.Packages) > 0 {
+				fmt.Fprintf(w, "%s (%s)\n", colorize(res.Cvss, v.CVE), strings.Join(v.Packages, ", "))
+			} else {
+				fmt.Fprintln(w, colorize(res.Cvss, v.CVE))
+			}
+		}
+	}
+	if len(res.Reasons) > 0 {
+		fmt.Fprintln(w, "Packages to upgrade:")
+		for _, v := range res.Reasons {
+			fmt.Fprintln(w, v.Upgrade(res.OS))
+		}
+	}
+	printUnfixable(w, res)
+}
+
+// printUnfixable writes reasons without available fix if they were separated with -only-fixable
+func printUnfixable(w io.Writer, res *scanner.ContainerResult) {
+	if len(res.Unfixable) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "Unfixable, no newer version is available:")
+	for _, v := range res.Unfixable {
+		fmt.Fprintln(w, v)
+	}
+}
+
+func printJSON(w io.Writer, results []*scanner.ContainerResult) error {
+	if results == nil {
+		results = []*scanner.ContainerResult{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(results)
+}
+
+// reporter writes results of scan in output format. Jsonl results are written by Result
+// as soon as container is scanned, other formats are written sorted by Report after the scan.
+type reporter struct {
+	w        io.Writer
+	format   string
+	sortBy   string
+	csvClean bool
+	top      int
+}
+
+// newReporter creates reporter that writes results to w in format set with flags
+func newReporter(w io.Writer) *reporter {
+	return &reporter{
+		w:        w,
+		format:   *output,
+		sortBy:   *sortBy,
+		csvClean: *csvClean,
+		top:      *topCVE,
+	}
+}
+
+// Result writes result of container if output is jsonl
+func (r *reporter) Result(res *scanner.ContainerResult) {
+	if r.format != "jsonl" {
+		return
+	}
+	if err := printJSONLine(r.w, res); err != nil {
+		errorf("Failed to write result for container %s: %v", res.ID, err)
+	}
+}
+
+// Report writes sorted results of all containers followed by summary for text output
+// and nothing for jsonl output since results are already written
+func (r *reporter) Report(results []*scanner.ContainerResult, run *scanRun) error {
+	sortResults(results, r.sortBy)
+	switch r.format {
+	case "jsonl":
+		return nil
+	case "json":
+		return printJSON(r.w, results)
+	case "sarif":
+		return printSARIF(r.w, results)
+	case "junit":
+		return printJUnit(r.w, results)
+	case "csv":
+		return printCSV(r.w, results, r.csvClean)
+	default:
+		for _, res := range results {
+			printText(r.w, res)
+		}
+		return printSummary(r.w, summarize(results, run, r.top))
+	}
+}
+
+// printJSONLine writes result as JSON object on a single line with one write,
+// so lines of containers scanned in parallel aren't mixed
+func printJSONLine(w io.Writer, res *scanner.ContainerResult) error {
+	data, err := json.Marshal(res)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// cveReasons returns reasons that list CVE or all reasons if Vulners didn't link CVE to reasons
+func cveReasons(vulns *scanner.Vulnerabilities, cve string) []scanner.Reason {
+	var result []scanner.Reason
+	for _, r := range vulns.Reasons {
+		for _, v := range r.Cvelist {
+			if v == cve {
+				result = append(result, r)
+				break
+			}
+		}
+	}
+	if len(result) == 0 {
+		return vulns.Reasons
+	}
+	return result
+}
+
+// printCSV writes one row per CVE of OS and language packages. Findings without CVE are written
+// with empty CVE as one row per reason or per bulletin if Vulners returned no reasons.
+// Clean containers are written with empty CVE and reasons if includeClean is set.
+func printCSV(w io.Writer, results []*scanner.ContainerResult, includeClean bool) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"container_id", "image", "os", "version", "cve", "cvss_score", "cvss_vector", "severity", "reasons"})
+	for _, res := range results {
+		row := func(v *scanner.Vulnerabilities, cve, reasons string) {
+			cw.Write([]string{res.ID, res.Image, res.OS, res.Version, cve, strconv.FormatFloat(v.Cvss, 'f', -1, 64), v.CvssVector, severityFromScore(v.Cvss), reasons})
+		}
+		rows := func(v *scanner.Vulnerabilities) {
+			for _, cve := range v.CVE {
+				var reasons []string
+				for _, r := range cveReasons(v, cve) {
+					reasons = append(reasons, r.String())
+				}
+				row(v, cve, strings.Join(reasons, "; "))
+			}
+			if len(v.CVE) > 0 {
+				return
+			}
+			for _, r := range v.Reasons {
+				row(v, "", r.String())
+			}
+			if len(v.Reasons) > 0 {
+				return
+			}
+			for _, b := range v.Bulletins {
+				row(v, "", "bulletin "+b)
+			}
+		}
+		if res.Count() == 0 && includeClean {
+			row(&res.Vulnerabilities, "", "")
+		}
+		rows(&res.Vulnerabilities)
+		for i := range res.Languages {
+			rows(&res.Languages[i].Vulnerabilities)
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/artemnikitin/vulnedock/scanner"
+)
+
+func TestLanguageFindingsInOutput(t *testing.T) {
+	res := &scanner.ContainerResult{ID: "c1", Image: "app:1", Languages: []scanner.LangResult{
+		{Ecosystem: "pip", PackageCount: 1, Vulnerabilities: scanner.Vulnerabilities{
+			CVE:       []string{"CVE-2023-32681"},
+			Bulletins: []string{"PYPI-1"},
+			Cvss:      6.1,
+			Reasons:   []scanner.Reason{{Package: "requests", ProvidedVersion: "2.30.0", BulletinID: "PYPI-1", Cvelist: []string{"CVE-2023-32681"}}},
+		}},
+	}}
+	if res.Count() != 2 || res.MaxCvss() != 6.1 {
+		t.Errorf("Count() = %d, MaxCvss() = %v, want 2 and 6.1", res.Count(), res.MaxCvss())
+	}
+
+	var buf bytes.Buffer
+	if err := printCSV(&buf, []*scanner.ContainerResult{res}, false); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "CVE-2023-32681") {
+		t.Errorf("CSV doesn't contain CVE of language package:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	if err := printSARIF(&buf, []*scanner.ContainerResult{res}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "CVE-2023-32681") {
+		t.Errorf("SARIF doesn't contain CVE of language package:\n%s", buf.String())
+	}
+}
+
+func TestCSVBulletinsWithoutCVE(t *testing.T) {
+	res := &scanner.ContainerResult{ID: "c1", Image: "alpine:3.12", Vulnerabilities: scanner.Vulnerabilities{
+		Bulletins: []string{"ALPINE-1", "ALPINE-2"},
+		Cvss:      5,
+		Reasons: []scanner.Reason{
+			{Package: "musl", ProvidedVersion: "1.1.24-r9", Operator: "lt", BulletinVersion: "1.1.24-r10", BulletinID: "ALPINE-1"},
+			{Package: "zlib", ProvidedVersion: "1.2.11-r3", Operator: "lt", BulletinVersion: "1.2.12-r0", BulletinID: "ALPINE-2"},
+		},
+	}}
+	var buf bytes.Buffer
+	if err := printCSV(&buf, []*scanner.ContainerResult{res}, true); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("CSV has %d lines, want header and a row per reason:\n%s", len(lines), buf.String())
+	}
+	if !strings.Contains(lines[1], "musl 1.1.24-r9") || !strings.Contains(lines[2], "zlib 1.2.11-r3") {
+		t.Errorf("rows don't contain reasons:\n%s", buf.String())
+	}
+
+	res.Reasons = nil
+	buf.Reset()
+	if err := printCSV(&buf, []*scanner.ContainerResult{res}, false); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "bulletin ALPINE-1") || !strings.Contains(buf.String(), "bulletin ALPINE-2") {
+		t.Errorf("rows don't contain bulletins without reasons:\n%s", buf.String())
+	}
+}
+
+func TestSortFindingsSortsCVEList(t *testing.T) {
+	res := &scanner.ContainerResult{ID: "c1", Vulnerabilities: scanner.Vulnerabilities{
+		CVE:  []string{"CVE-3", "CVE-1", "CVE-2"},
+		Cvss: 5,
+	}}
+	res.Findings = res.GroupByCVE()
+
+	sortFindings(res)
+	var got []string
+	for _, f := range res.Findings {
+		got = append(got, f.CVE)
+	}
+	if strings.Join(got, " ") != "CVE-1 CVE-2 CVE-3" {
+		t.Errorf("Findings = %q, want sorted CVE", got)
+	}
+
+	var buf bytes.Buffer
+	printContainerText(&buf, res)
+	out := buf.String()
+	if i1, i3 := strings.Index(out, "CVE-1"), strings.Index(out, "CVE-3"); i1 < 0 || i3 < i1 {
+		t.Errorf("text output doesn't list CVE in order:\n%s", out)
+	}
+}
+
+func TestRewindOutputReplacesReport(t *testing.T) {
+	f, err := createOutputFile(filepath.Join(t.TempDir(), "out", "results.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rep := &reporter{w: f, format: "json"}
+	run := &scanRun{Scanned: 1}
+	for _, id := range []string{"first-scan", "second"} {
+		if err := rewindOutput(f); err != nil {
+			t.Fatal(err)
+		}
+		if err := rep.Report([]*scanner.ContainerResult{{ID: id}}, run); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var results []scanner.ContainerResult
+	if err := json.Unmarshal(data, &results); err != nil {
+		t.Fatalf("file isn't a single JSON document: %v\n%s", err, data)
+	}
+	if len(results) != 1 || results[0].ID != "second" {
+		t.Errorf("results = %+v, want only results of the last scan", results)
+	}
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+
+	"github.com/artemnikitin/vulnedock/scanner"
+)
+
+// scanPackagesFile checks packages listed in file, one package per line in format
+// produced by package listing commands for the OS, e.g. "name version arch" for Debian
+func scanPackagesFile(ctx context.Context, s *scanner.Scanner, path, name, version string) (*scanner.ContainerResult, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.CheckPackages(ctx, &scanner.ContainerResult{
+		ID:      path,
+		OS:      name,
+		Version: version,
+	}, scanner.SplitPackages(string(data)))
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/artemnikitin/vulnedock/scanner"
+)
+
+// preflightTimeout limits time of every preflight check
+const preflightTimeout = 30 * time.Second
+
+// preflight checks that Docker daemons of targets and Vulners are reachable before the scan.
+// Vulners isn't checked if no requests are sent to it.
+func preflight(targets []scanTarget, auditor *scanner.HTTPAuditor, checkVulners bool) error {
+	for _, t := range targets {
+		if t.Scanner.Docker == nil {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), preflightTimeout)
+		_, err := t.Scanner.Docker.Ping(ctx)
+		cancel()
+		if err != nil {
+			if t.Name != "" {
+				return fmt.Errorf("Docker daemon of context %s isn't reachable: %v", t.Name, err)
+			}
+			return fmt.Errorf("Docker daemon isn't reachable: %v", err)
+		}
+	}
+
+	if checkVulners {
+		ctx, cancel := context.WithTimeout(context.Background(), preflightTimeout)
+		defer cancel()
+		if err := auditor.Ping(ctx); err != nil {
+			return fmt.Errorf("Vulners API %s isn't reachable: %v", auditor.URL, err)
+		}
+	}
+	return nil
+}
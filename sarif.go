@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/artemnikitin/vulnedock/scanner"
+)
+
+const (
+	sarifVersion = "2.1.0"
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+)
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+	HelpURI          string       `json:"helpUri"`
+}
+
+type sarifResult struct {
+	RuleID     string                 `json:"ruleId"`
+	Level      string                 `json:"level"`
+	Message    sarifMessage           `json:"message"`
+	Locations  []sarifLocation        `json:"locations"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+// sarifText returns message for CVE found in container, packages are included if they are known
+func sarifText(finding scanner.CVEFinding, res *scanner.ContainerResult) string {
+	text := fmt.Sprintf("%s found in container %s (%s %s)", finding.CVE, res.ID, res.OS, res.Version)
+	if len(finding.Packages) > 0 {
+		text += " in packages " + strings.Join(finding.Packages, ", ")
+	}
+	return text
+}
+
+// printSARIF writes results as SARIF document, every CVE is reported as a separate result
+func printSARIF(w io.Writer, results []*scanner.ContainerResult) error {
+	run := sarifRun{
+		Tool: sarifTool{
+			Driver: sarifDriver{
+				Name:           "vulnedock",
+				InformationURI: "https://github.com/artemnikitin/vulnedock",
+				Rules:          []sarifRule{},
+			},
+		},
+		Results: []sarifResult{},
+	}
+
+	rules := make(map[string]bool)
+	for _, res := range results {
+		add := func(finding scanner.CVEFinding, cvss float64) {
+			cve := finding.CVE
+			if !rules[cve] {
+				rules[cve] = true
+				run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{
+					ID:               cve,
+					ShortDescription: sarifMessage{Text: cve},
+					HelpURI:          "https://vulners.com/cve/" + cve,
+				})
+			}
+			run.Results = append(run.Results, sarifResult{
+				RuleID: cve,
+				Level:  "error",
+				Message: sarifMessage{
+					Text: sarifText(finding, res),
+				},
+				Locations: []sarifLocation{{
+					PhysicalLocation: sarifPhysicalLocation{
+						ArtifactLocation: sarifArtifactLocation{URI: res.ID},
+					},
+				}},
+				Properties: map[string]interface{}{"cvss": cvss},
+			})
+		}
+		for _, finding := range res.Findings {
+			add(finding, res.Cvss)
+		}
+		// Findings of language packages have own scores
+		for _, lang := range res.Languages {
+			for _, finding := range lang.GroupByCVE() {
+				add(finding, lang.Cvss)
+			}
+		}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(sarifLog{
+		Schema:  sarifSchema,
+		Version: sarifVersion,
+		Runs:    []sarifRun{run},
+	})
+}
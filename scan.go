@@ -0,0 +1,426 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/artemnikitin/vulnedock/scanner"
+	"github.com/docker/docker/api/types"
+)
+
+// scanRun contains results of scan of all containers
+type scanRun struct {
+	Results []*scanner.ContainerResult
+	Scanned int
+	Failed  int
+	Skipped int
+	// ExecDenied is number of containers that can't be scanned because daemon doesn't permit exec
+	ExecDenied int
+	// TimedOut is number of containers which scan exceeded -timeout-per-container
+	TimedOut int
+	Found    int
+}
+
+// errContainerTimeout is returned if scan of container exceeded -timeout-per-container
+var errContainerTimeout = errors.New("scan of container timed out")
+
+// scanWithTimeout calls scan with context limited by -timeout-per-container if it's set, so one
+// hung container doesn't use the whole -timeout. Error of scan that exceeded the limit wraps errContainerTimeout.
+func scanWithTimeout(ctx context.Context, scan func(ctx context.Context) (*scanner.ContainerResult, error)) (*scanner.ContainerResult, error) {
+	if *containerTimeout <= 0 {
+		return scan(ctx)
+	}
+	cctx, cancel := context.WithTimeout(ctx, *containerTimeout)
+	defer cancel()
+	res, err := scan(cctx)
+	if err != nil && cctx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+		return nil, fmt.Errorf("%w after %v: %v", errContainerTimeout, *containerTimeout, err)
+	}
+	return res, err
+}
+
+// scanTarget is scanner for Docker daemon, Name is Docker context or empty for default daemon
+type scanTarget struct {
+	Name    string
+	Scanner *scanner.Scanner
+}
+
+// runScans runs scan for every target and merges results, results are tagged with name of target.
+// Scan of remaining targets continues if listing of containers failed for one of several targets.
+func runScans(ctx context.Context, targets []scanTarget, report func(*scanner.ContainerResult)) (*scanRun, error) {
+	total := &scanRun{}
+	// Metrics of containers that vanished are removed only if containers of all targets were listed
+	scanMetrics.startRun()
+	listed := true
+	defer func() {
+		if listed {
+			scanMetrics.finishRun()
+		}
+	}()
+	for _, t := range targets {
+		name := t.Name
+		run, err := runScan(ctx, t.Scanner, func(res *scanner.ContainerResult) {
+			res.Context = name
+			if report != nil {
+				report(res)
+			}
+		})
+		if err != nil {
+			listed = false
+			if len(targets) == 1 {
+				return nil, err
+			}
+			errorf("Failed to scan Docker context %s: %v", name, err)
+			total.Failed++
+			continue
+		}
+		total.Results = append(total.Results, run.Results...)
+		total.Scanned += run.Scanned
+		total.Failed += run.Failed
+		total.Skipped += run.Skipped
+		total.ExecDenied += run.ExecDenied
+		total.TimedOut += run.TimedOut
+		total.Found += run.Found
+	}
+	return total, nil
+}
+
+// runScan scans packages from -packages-file, image set by -image or selected containers, report is called for every scanned container
+func runScan(ctx context.Context, s *scanner.Scanner, report func(*scanner.ContainerResult)) (*scanRun, error) {
+	// Responses are shared only during one run, so rescans in watch mode get fresh results
+	shared := *s
+	requests := newRequestCache(s.Vulners, s.Software)
+	shared.Vulners = requests
+	if s.Software != nil {
+		shared.Software = requests
+	}
+	s = &shared
+
+	run := &scanRun{}
+	var mu sync.Mutex
+	collect := func(id string, res *scanner.ContainerResult, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			var verr *scanner.VulnersError
+			if ctx.Err() == context.DeadlineExceeded {
+				errorf("Scan timed out after %v while scanning container %s: %v", *timeout, id, err)
+			} else if errors.Is(err, scanner.ErrExecNotPermitted) {
+				warnf("Skipping container %s: %v", id, err)
+				run.ExecDenied++
+				return
+			} else if errors.Is(err, errContainerTimeout) {
+				errorf("Skipping container %s: %v", id, err)
+				run.TimedOut++
+				return
+			} else if *skipUnsupported && errors.Is(err, scanner.ErrUnsupported) {
+				warnf("Skipping container %s: %v", id, err)
+				run.Skipped++
+				return
+			} else if errors.As(err, &verr) && verr.Kind == scanner.ErrorInvalidOS {
+				warnf("Skipping container %s: %v", id, err)
+			} else {
+				errorf("Failed to scan container %s: %v", id, err)
+			}
+			run.Failed++
+			return
+		}
+		sortFindings(res)
+		run.Scanned++
+		run.Found += res.Count()
+		if res.Request == nil {
+			scanMetrics.setVulnerabilities(res)
+		}
+		if report != nil {
+			report(res)
+		}
+		run.Results = append(run.Results, res)
+	}
+
+	// Progress is written to stderr if stdout is used for machine readable output
+	var progressOut io.Writer = os.Stdout
+	if *output != "text" || *outputFile != "" {
+		progressOut = os.Stderr
+	}
+	var started int
+	progress := func(total int, id, image string) {
+		if *quiet {
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		started++
+		fmt.Fprintf(progressOut, "[%d/%d] scanning %s (%s)\n", started, total, id, image)
+	}
+
+	if *packagesFile != "" {
+		progress(1, *packagesFile, "")
+		res, err := scanPackagesFile(ctx, s, *packagesFile, *osName, *osVersion)
+		collect(*packagesFile, res, err)
+		return run, nil
+	}
+
+	if *image != "" {
+		progress(1, *image, *image)
+		res, err := observeScan(*image, func() (*scanner.ContainerResult, error) {
+			return scanWithTimeout(ctx, func(ctx context.Context) (*scanner.ContainerResult, error) {
+				return s.ScanImage(ctx, *image)
+			})
+		})
+		collect(*image, res, err)
+		return run, nil
+	}
+
+	var selected []types.Container
+	if *containersFile != "" {
+		var missing int
+		selected, missing = inspectContainers(ctx, s.Docker, fileContainers)
+		run.Failed += missing
+	} else {
+		resp, err := s.Docker.ContainerList(ctx, types.ContainerListOptions{
+			All:     *includeStopped,
+			Filters: containerFilters(),
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		selected, err = selectContainers(resp, containers, *scanAll)
+		if err != nil {
+			return nil, err
+		}
+	}
+	selected = excludeContainers(selected, excluded)
+
+	var targets []types.Container
+	for _, v := range selected {
+		if !matchImage(v.Image, imagePatterns) {
+			debugf("Skipping container %s: image %s doesn't match -image-filter", v.ID, v.Image)
+			continue
+		}
+		if l := matchLabel(v.Labels, labelsNot); l != "" {
+			infof("Skipping container %s: it has label %s excluded with -label-not", v.ID, l)
+			continue
+		}
+		// Packages are listed via exec which requires a running container,
+		// so stopped containers can't be inspected for now and are skipped.
+		if v.State != "running" {
+			warnf("Skipping container %s: container is %s, only running containers can be scanned", v.ID, v.State)
+			continue
+		}
+		targets = append(targets, v)
+	}
+
+	cache := newImageCache()
+	jobs := make(chan types.Container)
+	var wg sync.WaitGroup
+	for i := 0; i < *concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for v := range jobs {
+				progress(len(targets), v.ID, v.Image)
+				res, err := cache.scan(v, func() (*scanner.ContainerResult, error) {
+					return observeScan(v.ID, func() (*scanner.ContainerResult, error) {
+						return scanWithTimeout(ctx, func(ctx context.Context) (*scanner.ContainerResult, error) {
+							return s.Scan(ctx, v)
+						})
+					})
+				})
+				collect(v.ID, res, err)
+			}
+		}()
+	}
+
+	for _, v := range targets {
+		select {
+		case jobs <- v:
+		case <-ctx.Done():
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	return run, nil
+}
+
+// inspectContainers returns containers with provided IDs or names without listing all containers,
+// containers that don't exist or can't be inspected are reported and counted as missing
+func inspectContainers(ctx context.Context, docker scanner.DockerClient, ids []string) ([]types.Container, int) {
+	var result []types.Container
+	var missing int
+	for _, id := range ids {
+		info, err := docker.ContainerInspect(ctx, id)
+		if err != nil {
+			errorf("Can't find container %q from -containers-from-file: %v", id, err)
+			missing++
+			continue
+		}
+		c := types.Container{ID: info.ID, Names: []string{info.Name}, ImageID: info.Image}
+		if info.Config != nil {
+			c.Image = info.Config.Image
+			c.Labels = info.Config.Labels
+		}
+		if info.State != nil {
+			c.State = info.State.Status
+		}
+		result = append(result, c)
+	}
+	return result, missing
+}
+
+// observeScan calls scan and records its duration for container in metrics
+func observeScan(id string, scan func() (*scanner.ContainerResult, error)) (*scanner.ContainerResult, error) {
+	start := time.Now()
+	defer func() {
+		scanMetrics.observeScan(id, time.Since(start))
+	}()
+	return scan()
+}
+
+// watchScans rescans containers with interval until SIGINT or SIGTERM is received.
+// Only vulnerabilities that weren't found by previous scan are reported unless -watch-full is set.
+// Formats that are a single document, e.g. json or sarif, can't be appended to, so such -output-file
+// is rewritten with all results of every scan.
+func watchScans(targets []scanTarget, rep *reporter, interval time.Duration) {
+	sigCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	rewrite := *outputFile != "" && rep.format != "text" && rep.format != "jsonl"
+	full := *watchFull || rewrite
+	seen := make(map[string]map[string]bool)
+	for {
+		var report func(*scanner.ContainerResult)
+		if full {
+			report = rep.Result
+		}
+
+		ctx, cancel := context.WithTimeout(sigCtx, *timeout)
+		run, err := runScans(ctx, targets, report)
+		cancel()
+		if sigCtx.Err() != nil {
+			infof("Watch mode is stopped")
+			return
+		}
+
+		if err != nil {
+			errorf("Scan failed: %v", err)
+		} else if rewrite {
+			if err = rewindOutput(rep.w); err == nil {
+				err = rep.Report(run.Results, run)
+			}
+		} else if *watchFull {
+			err = rep.Report(run.Results, run)
+		} else {
+			err = writeNewFindings(rep, newFindings(run.Results, seen), run)
+		}
+		if err != nil {
+			errorf("Failed to write results: %v", err)
+		}
+
+		select {
+		case <-sigCtx.Done():
+			infof("Watch mode is stopped")
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// rewindOutput truncates output file, so the next report replaces previous one
+func rewindOutput(w io.Writer) error {
+	f, ok := w.(*os.File)
+	if !ok {
+		return nil
+	}
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	_, err := f.Seek(0, io.SeekStart)
+	return err
+}
+
+func writeNewFindings(rep *reporter, results []*scanner.ContainerResult, run *scanRun) error {
+	if rep.format == "jsonl" {
+		for _, res := range results {
+			if err := printJSONLine(rep.w, res); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if rep.format != "text" {
+		return rep.Report(results, run)
+	}
+	if len(results) == 0 {
+		_, err := fmt.Fprintf(rep.w, "%s: no new vulnerabilities found\n", time.Now().Format(time.RFC3339))
+		return err
+	}
+	sortResults(results, rep.sortBy)
+	for _, res := range results {
+		printText(rep.w, res)
+	}
+	return nil
+}
+
+// newFindings returns results with only vulnerabilities that aren't in seen
+// and replaces seen IDs of every container with IDs from results
+func newFindings(results []*scanner.ContainerResult, seen map[string]map[string]bool) []*scanner.ContainerResult {
+	var diff []*scanner.ContainerResult
+	for _, res := range results {
+		prev := seen[res.ID]
+		current := make(map[string]bool)
+
+		filtered := *res
+		filtered.CVE, filtered.Bulletins, filtered.Reasons = nil, nil, nil
+		for _, cve := range res.CVE {
+			current[cve] = true
+			if !prev[cve] {
+				filtered.CVE = append(filtered.CVE, cve)
+			}
+		}
+		for _, r := range res.Reasons {
+			current[r.BulletinID] = true
+			if !prev[r.BulletinID] {
+				filtered.Bulletins = append(filtered.Bulletins, r.BulletinID)
+				filtered.Reasons = append(filtered.Reasons, r)
+			}
+		}
+
+		// Findings of language packages are keyed by ecosystem, since the same bulletin can cover several of them
+		filtered.Languages = nil
+		for _, lang := range res.Languages {
+			newLang := lang
+			newLang.CVE, newLang.Bulletins, newLang.Reasons = nil, nil, nil
+			for _, cve := range lang.CVE {
+				current[lang.Ecosystem+":"+cve] = true
+				if !prev[lang.Ecosystem+":"+cve] {
+					newLang.CVE = append(newLang.CVE, cve)
+				}
+			}
+			for _, r := range lang.Reasons {
+				current[lang.Ecosystem+":"+r.BulletinID] = true
+				if !prev[lang.Ecosystem+":"+r.BulletinID] {
+					newLang.Bulletins = append(newLang.Bulletins, r.BulletinID)
+					newLang.Reasons = append(newLang.Reasons, r)
+				}
+			}
+			if newLang.Count() > 0 {
+				filtered.Languages = append(filtered.Languages, newLang)
+			}
+		}
+
+		seen[res.ID] = current
+		filtered.Findings = filtered.GroupByCVE()
+		if filtered.Count() > 0 {
+			diff = append(diff, &filtered)
+		}
+	}
+	return diff
+}
@@ -0,0 +1,153 @@
+package scanner
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/errdefs"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+// errMissingCommand is returned if command doesn't exist in container, e.g. in distroless or scratch images
+var errMissingCommand = errors.New("command not found in container")
+
+// ErrExecNotPermitted is returned if Docker daemon forbids exec in container, e.g. with authorization plugin
+var ErrExecNotPermitted = errors.New("unscannable: exec not permitted")
+
+// isExecForbidden checks if exec failed because daemon doesn't permit it
+func isExecForbidden(err error) bool {
+	if errdefs.IsForbidden(err) || errdefs.IsUnauthorized(err) {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "permission denied") || strings.Contains(msg, "authorization denied")
+}
+
+const (
+	// execRetries is number of retries of exec create and attach if they failed with transient error
+	execRetries = 2
+	// execRetryDelay is delay before the first retry, it grows with every retry
+	execRetryDelay = 500 * time.Millisecond
+)
+
+// isTransientExecError checks if exec create or attach failed because of connection to busy daemon,
+// e.g. connection reset, and can be retried. Errors returned by daemon, e.g. no such container, are permanent.
+func isTransientExecError(err error) bool {
+	if errors.Is(err, ErrExecNotPermitted) || errdefs.IsNotFound(err) || errdefs.IsConflict(err) || errdefs.IsInvalidParameter(err) {
+		return false
+	}
+	if errdefs.IsUnavailable(err) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "connection reset") || strings.Contains(msg, "broken pipe")
+}
+
+// isMissingCommand checks if command failed to start because executable doesn't exist in container
+func isMissingCommand(res *execResult) bool {
+	if res.ExitCode != 126 && res.ExitCode != 127 {
+		return false
+	}
+	out := res.Stdout + res.Stderr
+	return strings.Contains(out, "executable file not found") || strings.Contains(out, "no such file or directory")
+}
+
+// execResult contains output and exit code of command executed in container
+type execResult struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int
+}
+
+// executeCmd runs command in container and returns its output and exit code
+func executeCmd(cli DockerClient, ctx context.Context, ID string, cmd []string) (*execResult, error) {
+	params := types.ExecConfig{
+		AttachStderr: true,
+		AttachStdout: true,
+		Cmd:          cmd,
+	}
+
+	var execID string
+	var hijack types.HijackedResponse
+	for attempt := 0; ; attempt++ {
+		var err error
+		execID, hijack, err = startExec(cli, ctx, ID, params)
+		if err == nil {
+			break
+		}
+		if attempt >= execRetries || ctx.Err() != nil || !isTransientExecError(err) {
+			return nil, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(time.Duration(attempt+1) * execRetryDelay):
+		}
+	}
+	defer hijack.Close()
+
+	// Reading from hijacked connection doesn't stop when context is done, so connection is closed
+	// to stop commands that hang, e.g. because of deadline of container scan
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			hijack.Close()
+		case <-done:
+		}
+	}()
+
+	// Without TTY output is multiplexed with headers for stdout and stderr
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	if _, err := stdcopy.StdCopy(stdout, stderr, hijack.Reader); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+
+	inspect, err := cli.ContainerExecInspect(ctx, execID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &execResult{
+		Stdout:   stdout.String(),
+		Stderr:   stderr.String(),
+		ExitCode: inspect.ExitCode,
+	}, nil
+}
+
+// startExec creates exec of command in container and attaches to it
+func startExec(cli DockerClient, ctx context.Context, ID string, params types.ExecConfig) (string, types.HijackedResponse, error) {
+	resp, err := cli.ContainerExecCreate(ctx, ID, params)
+	if err != nil {
+		if isExecForbidden(err) {
+			return "", types.HijackedResponse{}, fmt.Errorf("%w: %v", ErrExecNotPermitted, err)
+		}
+		return "", types.HijackedResponse{}, err
+	}
+
+	hijack, err := cli.ContainerExecAttach(ctx, resp.ID, types.ExecStartCheck{})
+	if err != nil {
+		if isExecForbidden(err) {
+			return "", types.HijackedResponse{}, fmt.Errorf("%w: %v", ErrExecNotPermitted, err)
+		}
+		return "", types.HijackedResponse{}, err
+	}
+	return resp.ID, hijack, nil
+}
@@ -0,0 +1,151 @@
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/pkg/stdcopy"
+	specs "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// fakeExec is output of command in fake container, stream is multiplexed like output of exec without TTY
+type fakeExec struct {
+	stream   []byte
+	exitCode int
+}
+
+// fakeDocker is DockerClient that returns outputs of commands keyed by command joined with spaces,
+// commands without output exit with code 127 like missing executables
+type fakeDocker struct {
+	info  types.ContainerJSON
+	execs map[string]fakeExec
+	// created contains commands in order of exec create
+	created []string
+}
+
+func (f *fakeDocker) ContainerList(ctx context.Context, options types.ContainerListOptions) ([]types.Container, error) {
+	return nil, nil
+}
+
+func (f *fakeDocker) ContainerInspect(ctx context.Context, id string) (types.ContainerJSON, error) {
+	if f.info.ContainerJSONBase == nil {
+		return types.ContainerJSON{ContainerJSONBase: &types.ContainerJSONBase{ID: id, Platform: "linux"}}, nil
+	}
+	return f.info, nil
+}
+
+func (f *fakeDocker) ContainerExecCreate(ctx context.Context, id string, config types.ExecConfig) (types.IDResponse, error) {
+	cmd := strings.Join(config.Cmd, " ")
+	f.created = append(f.created, cmd)
+	return types.IDResponse{ID: cmd}, nil
+}
+
+func (f *fakeDocker) ContainerExecAttach(ctx context.Context, execID string, config types.ExecStartCheck) (types.HijackedResponse, error) {
+	exec, ok := f.execs[execID]
+	stream := exec.stream
+	if !ok {
+		stream = muxStream("", "exec: \"sh\": executable file not found in $PATH")
+	}
+	conn, _ := net.Pipe()
+	return types.HijackedResponse{Conn: conn, Reader: bufio.NewReader(bytes.NewReader(stream))}, nil
+}
+
+func (f *fakeDocker) ContainerExecInspect(ctx context.Context, execID string) (types.ContainerExecInspect, error) {
+	exec, ok := f.execs[execID]
+	if !ok {
+		return types.ContainerExecInspect{ExecID: execID, ExitCode: 127}, nil
+	}
+	return types.ContainerExecInspect{ExecID: execID, ExitCode: exec.exitCode}, nil
+}
+
+func (f *fakeDocker) ContainerCreate(ctx context.Context, config *container.Config, hostConfig *container.HostConfig, networkingConfig *network.NetworkingConfig, platform *specs.Platform, containerName string) (container.ContainerCreateCreatedBody, error) {
+	return container.ContainerCreateCreatedBody{}, errors.New("not implemented")
+}
+
+func (f *fakeDocker) ContainerStart(ctx context.Context, id string, options types.ContainerStartOptions) error {
+	return errors.New("not implemented")
+}
+
+func (f *fakeDocker) ContainerRemove(ctx context.Context, id string, options types.ContainerRemoveOptions) error {
+	return nil
+}
+
+func (f *fakeDocker) Ping(ctx context.Context) (types.Ping, error) {
+	return types.Ping{}, nil
+}
+
+// muxStream returns stdout and stderr multiplexed with stdcopy headers
+func muxStream(stdout, stderr string) []byte {
+	var buf bytes.Buffer
+	if stdout != "" {
+		stdcopy.NewStdWriter(&buf, stdcopy.Stdout).Write([]byte(stdout))
+	}
+	if stderr != "" {
+		stdcopy.NewStdWriter(&buf, stdcopy.Stderr).Write([]byte(stderr))
+	}
+	return buf.Bytes()
+}
+
+func TestExecuteCmdDemultiplexesOutput(t *testing.T) {
+	// Captured from exec of "sh -c 'echo ubuntu; echo warning >&2; echo 20.04'", frames of streams interleave
+	stream := []byte("\x01\x00\x00\x00\x00\x00\x00\x07ubuntu\n" +
+		"\x02\x00\x00\x00\x00\x00\x00\x08warning\n" +
+		"\x01\x00\x00\x00\x00\x00\x00\x0620.04\n")
+	cli := &fakeDocker{execs: map[string]fakeExec{"cat /etc/os-release": {stream: stream}}}
+
+	res, err := executeCmd(cli, context.Background(), "c1", OSVersion)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if res.Stdout != "ubuntu\n20.04\n" {
+		t.Errorf("Stdout = %q, want %q", res.Stdout, "ubuntu\n20.04\n")
+	}
+	if res.Stderr != "warning\n" {
+		t.Errorf("Stderr = %q, want %q", res.Stderr, "warning\n")
+	}
+	if res.ExitCode != 0 {
+		t.Errorf("ExitCode = %d, want 0", res.ExitCode)
+	}
+}
+
+func TestExecuteCmdReturnsExitCode(t *testing.T) {
+	cli := &fakeDocker{execs: map[string]fakeExec{
+		"rpm -qa": {stream: muxStream("", "error: rpmdb open failed\n"), exitCode: 1},
+	}}
+
+	res, err := executeCmd(cli, context.Background(), "c1", CentOSPackages)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if res.ExitCode != 1 || res.Stdout != "" || res.Stderr != "error: rpmdb open failed\n" {
+		t.Errorf("result = %+v, want exit code 1 with stderr only", res)
+	}
+}
+
+func TestExecuteCmdMissingCommand(t *testing.T) {
+	res, err := executeCmd(&fakeDocker{}, context.Background(), "c1", AlpinePackages)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !isMissingCommand(res) {
+		t.Errorf("result = %+v, want missing command", res)
+	}
+}
+
+func TestExecuteCmdMalformedStream(t *testing.T) {
+	// Header announces stream 5 that doesn't exist
+	stream := []byte("\x05\x00\x00\x00\x00\x00\x00\x02ok")
+	cli := &fakeDocker{execs: map[string]fakeExec{"pacman -Q": {stream: stream}}}
+
+	if _, err := executeCmd(cli, context.Background(), "c1", ArchPackages); err == nil {
+		t.Error("expected error for malformed stream")
+	}
+}
@@ -0,0 +1,95 @@
+package scanner
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DefaultFormatVersion is version of Vulners audit API used if no version is set
+const DefaultFormatVersion = "v3"
+
+// apiFormat encodes requests and decodes responses for a version of Vulners audit API
+type apiFormat struct {
+	encode func(rb *RequestBody) ([]byte, error)
+	decode func(data []byte) (*ResponseBody, error)
+}
+
+// apiFormats contains supported versions of Vulners audit API, support of a new version
+// is added by converting its request and response to RequestBody and ResponseBody
+var apiFormats = map[string]apiFormat{
+	"v3": {encode: encodeV3, decode: decodeV3},
+}
+
+func encodeV3(rb *RequestBody) ([]byte, error) {
+	return json.Marshal(rb)
+}
+
+// ErrMalformedResponse is returned if response of Vulners doesn't have expected structure,
+// otherwise missing fields would be decoded as zero values and container would be reported as clean
+var ErrMalformedResponse = errors.New("malformed response from Vulners")
+
+func decodeV3(data []byte) (*ResponseBody, error) {
+	if err := validateV3(data); err != nil {
+		return nil, err
+	}
+	body := &ResponseBody{}
+	if err := json.Unmarshal(data, body); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedResponse, err)
+	}
+	return body, nil
+}
+
+// validateV3 checks that response has result and that successful response has data object
+func validateV3(data []byte) error {
+	var raw struct {
+		Result *string          `json:"result"`
+		Data   *json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return fmt.Errorf("%w: %v", ErrMalformedResponse, err)
+	}
+	if raw.Result == nil || *raw.Result == "" {
+		return fmt.Errorf("%w: result is missing", ErrMalformedResponse)
+	}
+	if *raw.Result == "OK" && (raw.Data == nil || !bytes.HasPrefix(bytes.TrimSpace(*raw.Data), []byte("{"))) {
+		return fmt.Errorf("%w: result is OK, but data object is missing", ErrMalformedResponse)
+	}
+	return nil
+}
+
+// getFormat returns format for version of Vulners audit API, empty version means DefaultFormatVersion
+func getFormat(version string) (apiFormat, error) {
+	if version == "" {
+		version = DefaultFormatVersion
+	}
+	f, ok := apiFormats[version]
+	if !ok {
+		return apiFormat{}, fmt.Errorf("unsupported Vulners API version %q, supported versions: %s", version, strings.Join(FormatVersions(), ", "))
+	}
+	return f, nil
+}
+
+// FormatVersions returns supported versions of Vulners audit API
+func FormatVersions() []string {
+	var result []string
+	for k := range apiFormats {
+		result = append(result, k)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// AuditURL returns URL of Vulners audit API for version
+func AuditURL(version string) (string, error) {
+	if version == "" {
+		version = DefaultFormatVersion
+	}
+	if _, err := getFormat(version); err != nil {
+		return "", err
+	}
+	return "https://vulners.com/api/" + version + "/audit/audit/", nil
+}
@@ -0,0 +1,47 @@
+package scanner
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDecodeV3TruncatedResponse(t *testing.T) {
+	// auditResponse cut at different points, e.g. because connection was closed
+	for _, n := range []int{0, 1, 12, 30, 200, len(auditResponse) - 1} {
+		data := []byte(auditResponse[:n])
+		if err := validateV3(data); !errors.Is(err, ErrMalformedResponse) {
+			t.Errorf("validateV3 of %d bytes: error = %v, want ErrMalformedResponse", n, err)
+		}
+		if body, err := decodeV3(data); !errors.Is(err, ErrMalformedResponse) || body != nil {
+			t.Errorf("decodeV3 of %d bytes = %v, %v, want ErrMalformedResponse", n, body, err)
+		}
+	}
+}
+
+func TestDecodeV3(t *testing.T) {
+	body, err := decodeV3([]byte(auditResponse))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if body.Result != "OK" || len(body.Data.Cvelist) != 2 {
+		t.Errorf("decodeV3() = %+v, want OK response with 2 CVE", body)
+	}
+
+	tests := []string{
+		`{}`,
+		`{"result": ""}`,
+		`{"result": "OK"}`,
+		`{"result": "OK", "data": null}`,
+		`{"result": "OK", "data": []}`,
+		`[]`,
+	}
+	for _, data := range tests {
+		if err := validateV3([]byte(data)); !errors.Is(err, ErrMalformedResponse) {
+			t.Errorf("validateV3(%s): error = %v, want ErrMalformedResponse", data, err)
+		}
+	}
+
+	if err := validateV3([]byte(`{"result": "error", "data": {"error": "Wrong API key"}}`)); err != nil {
+		t.Errorf("validateV3 of error response: unexpected error %v", err)
+	}
+}
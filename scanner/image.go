@@ -0,0 +1,38 @@
+package scanner
+
+import (
+	"context"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+)
+
+// ScanImage creates temporary container from image, scans it and removes it.
+// Image must be available locally and contain sleep.
+func (s *Scanner) ScanImage(ctx context.Context, ref string) (*ContainerResult, error) {
+	config := &container.Config{
+		Image: ref,
+		// Keep container running long enough to execute commands in it
+		Entrypoint: []string{"sleep"},
+		Cmd:        []string{"3600"},
+	}
+	created, err := s.Docker.ContainerCreate(ctx, config, nil, nil, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err := s.Docker.ContainerRemove(context.Background(), created.ID, types.ContainerRemoveOptions{
+			Force:         true,
+			RemoveVolumes: true,
+		})
+		if err != nil {
+			s.logger().Warnf("Failed to remove temporary container %s: %v", created.ID, err)
+		}
+	}()
+
+	if err := s.Docker.ContainerStart(ctx, created.ID, types.ContainerStartOptions{}); err != nil {
+		return nil, err
+	}
+
+	return s.Scan(ctx, types.Container{ID: created.ID, Image: ref})
+}
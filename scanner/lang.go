@@ -0,0 +1,254 @@
+package scanner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// SoftwareURL is URL of Vulners software API that returns vulnerabilities of one product version
+const SoftwareURL = "https://vulners.com/api/v3/burp/software/"
+
+// LangPackages contains commands that list packages of language ecosystems, they are used with ScanLang
+var LangPackages = map[string][]string{
+	"pip": {"pip", "list", "--format=freeze", "--disable-pip-version-check"},
+	"npm": {"npm", "ls", "--global", "--depth=0", "--json"},
+	"gem": {"gem", "list", "--local"},
+}
+
+// LangResult contains vulnerabilities of packages of one language ecosystem
+type LangResult struct {
+	Ecosystem    string `json:"ecosystem"`
+	PackageCount int    `json:"package_count"`
+	Vulnerabilities
+}
+
+// SoftwareClient checks version of software for known vulnerabilities
+type SoftwareClient interface {
+	GetSoftwareVulnerabilities(ctx context.Context, name, version string) (*Vulnerabilities, error)
+}
+
+// softwareURL returns URL of software API on the same host as audit API, so language packages
+// are checked by on-premise instance too. Default SoftwareURL is returned for invalid URL.
+func softwareURL(auditURL string) string {
+	u, err := url.Parse(auditURL)
+	if err != nil || u.Host == "" {
+		return SoftwareURL
+	}
+	prefix := ""
+	if i := strings.Index(u.Path, "/api/"); i > 0 {
+		prefix = u.Path[:i]
+	}
+	return u.Scheme + "://" + u.Host + prefix + "/api/v3/burp/software/"
+}
+
+// softwareRequest is body of request to Vulners software API, API key is sent in body
+// like for audit API so it doesn't end up in URL that is included in errors of HTTP client
+type softwareRequest struct {
+	Software string `json:"software"`
+	Version  string `json:"version"`
+	Type     string `json:"type"`
+	APIKey   string `json:"apiKey,omitempty"`
+}
+
+// softwareResponse is response of Vulners software API
+type softwareResponse struct {
+	Result string `json:"result"`
+	Data   struct {
+		Error     string `json:"error"`
+		ErrorCode int    `json:"errorCode"`
+		Search    []struct {
+			Source struct {
+				ID      string   `json:"id"`
+				Cvelist []string `json:"cvelist"`
+				Cvss    struct {
+					Score  float64 `json:"score"`
+					Vector string  `json:"vector"`
+				} `json:"cvss"`
+			} `json:"_source"`
+		} `json:"search"`
+	} `json:"data"`
+}
+
+// GetSoftwareVulnerabilities requests vulnerabilities of software version from Vulners software API.
+// Vulners returns warning instead of OK result if nothing is found, it's treated as no vulnerabilities.
+func (a *HTTPAuditor) GetSoftwareVulnerabilities(ctx context.Context, name, version string) (*Vulnerabilities, error) {
+	apiURL := a.SoftwareURL
+	if apiURL == "" {
+		apiURL = SoftwareURL
+	}
+	request := softwareRequest{Software: name, Version: version, Type: "software", APIKey: a.APIKey}
+	data, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	requestID := newRequestID()
+	resp, err := a.doWithRetry(ctx, http.MethodPost, apiURL, data, requestID)
+	if err != nil {
+		a.logSoftwareRequest(ctx, request, requestID, "", 0, err)
+		return nil, err
+	}
+	a.logSoftwareRequest(ctx, request, requestID, resp.Header.Get(RequestIDHeader), resp.StatusCode, nil)
+	defer func() {
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+
+	r, err := responseReader(resp)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	data, err = ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var body softwareResponse
+	if err := json.Unmarshal(data, &body); err != nil {
+		return nil, fmt.Errorf("vulners returned %d with invalid response: %v", resp.StatusCode, err)
+	}
+	if body.Result == "warning" {
+		return &Vulnerabilities{}, nil
+	}
+	if body.Result != "OK" {
+		return nil, newVulnersError(body.Data.ErrorCode, body.Data.Error)
+	}
+
+	result := &Vulnerabilities{}
+	seen := make(map[string]bool)
+	for _, v := range body.Data.Search {
+		src := v.Source
+		result.Bulletins = append(result.Bulletins, src.ID)
+		result.Reasons = append(result.Reasons, Reason{
+			Package:         name,
+			ProvidedVersion: version,
+			ProvidedPackage: name + " " + version,
+			BulletinID:      src.ID,
+			Cvelist:         src.Cvelist,
+		})
+		for _, cve := range src.Cvelist {
+			if !seen[cve] {
+				seen[cve] = true
+				result.CVE = append(result.CVE, cve)
+			}
+		}
+		if src.Cvss.Score > result.Cvss {
+			result.Cvss, result.CvssVector = src.Cvss.Score, src.Cvss.Vector
+		}
+	}
+	return result, nil
+}
+
+// parseLangPackages returns packages in form "name version" from output of command of ecosystem
+func parseLangPackages(ecosystem, text string) ([][2]string, error) {
+	var result [][2]string
+	switch ecosystem {
+	case "pip":
+		// name==version
+		for _, line := range SplitPackages(text) {
+			if i := strings.Index(line, "=="); i > 0 {
+				result = append(result, [2]string{line[:i], line[i+2:]})
+			}
+		}
+	case "npm":
+		var out struct {
+			Dependencies map[string]struct {
+				Version string `json:"version"`
+			} `json:"dependencies"`
+		}
+		if err := json.Unmarshal([]byte(text), &out); err != nil {
+			return nil, err
+		}
+		for name, v := range out.Dependencies {
+			if v.Version != "" {
+				result = append(result, [2]string{name, v.Version})
+			}
+		}
+		sort.Slice(result, func(i, j int) bool { return result[i][0] < result[j][0] })
+	case "gem":
+		// name (1.2.3, default: 1.2.0)
+		for _, line := range SplitPackages(text) {
+			i := strings.Index(line, " (")
+			if i < 1 || !strings.HasSuffix(line, ")") {
+				continue
+			}
+			for _, v := range strings.Split(line[i+2:len(line)-1], ",") {
+				v = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(v), "default:"))
+				if v != "" {
+					result = append(result, [2]string{line[:i], v})
+				}
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unknown ecosystem %s", ecosystem)
+	}
+	return result, nil
+}
+
+// scanLang lists packages of language ecosystems in container and checks them with Software client.
+// Ecosystems without command in container are skipped.
+func (s *Scanner) scanLang(ctx context.Context, id string, run func(cmd []string) (string, error)) ([]LangResult, error) {
+	log := s.logger()
+	var ecosystems []string
+	for k := range LangPackages {
+		ecosystems = append(ecosystems, k)
+	}
+	sort.Strings(ecosystems)
+
+	var results []LangResult
+	for _, ecosystem := range ecosystems {
+		text, err := run(LangPackages[ecosystem])
+		if err != nil {
+			if errors.Is(err, ErrExecNotPermitted) || ctx.Err() != nil {
+				return nil, err
+			}
+			log.Debugf("Skipping %s packages of container %s: %v", ecosystem, id, err)
+			continue
+		}
+		pkgs, err := parseLangPackages(ecosystem, text)
+		if err != nil {
+			log.Warnf("Can't parse %s packages of container %s: %v", ecosystem, id, err)
+			continue
+		}
+		if len(pkgs) == 0 {
+			continue
+		}
+
+		res := LangResult{Ecosystem: ecosystem, PackageCount: len(pkgs)}
+		seen := make(map[string]bool)
+		if s.DryRun {
+			log.Infof("Found %d %s packages in container %s, they aren't checked in dry run", len(pkgs), ecosystem, id)
+			results = append(results, res)
+			continue
+		}
+		for _, pkg := range pkgs {
+			vulns, err := s.Software.GetSoftwareVulnerabilities(WithContainerID(ctx, id), pkg[0], pkg[1])
+			if err != nil {
+				return nil, fmt.Errorf("can't check %s package %s %s: %w", ecosystem, pkg[0], pkg[1], err)
+			}
+			for _, cve := range vulns.CVE {
+				if !seen[cve] {
+					seen[cve] = true
+					res.CVE = append(res.CVE, cve)
+				}
+			}
+			res.Bulletins = append(res.Bulletins, vulns.Bulletins...)
+			res.Reasons = append(res.Reasons, vulns.Reasons...)
+			if vulns.Cvss > res.Cvss {
+				res.Cvss, res.CvssVector = vulns.Cvss, vulns.CvssVector
+			}
+		}
+		res.applyIgnored(s.Ignored)
+		res.applyIgnoredPackages(s.IgnoredPackages)
+		res.applyThreshold(s.MinCVSS)
+		results = append(results, res)
+	}
+	return results, nil
+}
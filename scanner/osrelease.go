@@ -0,0 +1,194 @@
+package scanner
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var redHatReleaseRegexp = regexp.MustCompile(`^(.+?)\s+release\s+([0-9][0-9.]*)`)
+
+// RedHatReleaseNames maps distribution name from /etc/redhat-release to OS ID
+var RedHatReleaseNames = map[string]string{
+	"centos":                   "centos",
+	"red hat enterprise linux": "rhel",
+	"fedora":                   "fedora",
+	"oracle linux":             "oraclelinux",
+	"rocky linux":              "rocky",
+	"almalinux":                "almalinux",
+}
+
+// detectOS returns OS information in os-release format. If /etc/os-release is absent
+// or doesn't contain ID, then /etc/lsb-release and /etc/redhat-release are used.
+func detectOS(run func(cmd []string) (string, error)) (string, error) {
+	text, err := run(OSVersion)
+	if err == nil && parseOSRelease(text)["ID"] != "" {
+		return text, nil
+	}
+	if errors.Is(err, errMissingCommand) {
+		return "", err
+	}
+
+	if text, err := run(LSBRelease); err == nil {
+		info := parseOSRelease(text)
+		if info["DISTRIB_ID"] != "" {
+			return fmt.Sprintf("ID=%s\nVERSION_ID=%s\n", strings.ToLower(info["DISTRIB_ID"]), info["DISTRIB_RELEASE"]), nil
+		}
+	}
+
+	if text, err := run(RedHatRelease); err == nil {
+		if name, version := parseRedHatRelease(text); name != "" {
+			return fmt.Sprintf("ID=%s\nVERSION_ID=%s\n", name, version), nil
+		}
+	}
+
+	return "", errors.New("can't read OS information from /etc/os-release, /etc/lsb-release or /etc/redhat-release")
+}
+
+// parseRedHatRelease returns OS ID and version from /etc/redhat-release,
+// e.g. "CentOS Linux release 7.9.2009 (Core)" is parsed into "centos" and "7.9.2009"
+func parseRedHatRelease(text string) (string, string) {
+	m := redHatReleaseRegexp.FindStringSubmatch(strings.TrimSpace(text))
+	if m == nil {
+		return "", ""
+	}
+	distro := strings.ToLower(m[1])
+	for k, v := range RedHatReleaseNames {
+		if strings.HasPrefix(distro, k) {
+			return v, m[2]
+		}
+	}
+	return "", ""
+}
+
+// parseOSRelease parses content of /etc/os-release into map of keys and values.
+// Values can be quoted with single or double quotes and quoted values can span several lines.
+func parseOSRelease(text string) map[string]string {
+	result := make(map[string]string)
+	lines := strings.Split(strings.Replace(text, "\r", "", -1), "\n")
+
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		eq := strings.Index(line, "=")
+		if eq < 1 {
+			continue
+		}
+		key := strings.TrimSpace(line[:eq])
+		value := strings.TrimSpace(line[eq+1:])
+
+		if value != "" && (value[0] == '"' || value[0] == '\'') {
+			quote := value[:1]
+			value = value[1:]
+			// value continues on next lines until closing quote
+			for !strings.HasSuffix(value, quote) && i+1 < len(lines) {
+				i++
+				value += "\n" + strings.TrimRight(lines[i], " \t")
+			}
+			value = strings.TrimSuffix(value, quote)
+			if quote == "\"" {
+				value = unescapeOSReleaseValue(value)
+			}
+		}
+		result[key] = value
+	}
+
+	return result
+}
+
+// unescapeOSReleaseValue handles backslash escapes allowed in double quoted values
+func unescapeOSReleaseValue(value string) string {
+	if !strings.Contains(value, "\\") {
+		return value
+	}
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' && i+1 < len(value) && strings.IndexByte("\\\"$`", value[i+1]) > -1 {
+			i++
+		}
+		b.WriteByte(value[i])
+	}
+	return b.String()
+}
+
+// GetOSNameAndVersion returns ID and VERSION_ID from content of /etc/os-release,
+// absent values are returned as empty strings. Debian testing and some minimal images
+// don't have VERSION_ID, then version is taken from VERSION_CODENAME. Versions of Alpine edge
+// are normalized with alpineEdgeVersion.
+func GetOSNameAndVersion(text string) (string, string) {
+	info := parseOSRelease(text)
+	id, version := info["ID"], info["VERSION_ID"]
+	if version == "" && (id == "debian" || id == "ubuntu") {
+		version = codenameVersion(info["VERSION_CODENAME"])
+	}
+	if isAlpineEdge(info) {
+		version = alpineEdgeVersion(version)
+	}
+	return id, version
+}
+
+// IsAlpineEdge checks if content of /etc/os-release belongs to Alpine edge,
+// packages of edge aren't pinned to release, so Vulners matching is best-effort
+func IsAlpineEdge(text string) bool {
+	return isAlpineEdge(parseOSRelease(text))
+}
+
+// isAlpineEdge checks if Alpine is edge: VERSION_ID is absent or "edge", has pre-release suffix
+// like "3.19.0_alpha20231219" or PRETTY_NAME is "Alpine Linux edge"
+func isAlpineEdge(info map[string]string) bool {
+	if info["ID"] != "alpine" {
+		return false
+	}
+	version := info["VERSION_ID"]
+	return version == "" || version == "edge" || strings.Contains(version, "_") ||
+		strings.HasSuffix(strings.ToLower(info["PRETTY_NAME"]), " edge")
+}
+
+// alpineEdgeVersion returns release edge is based on, e.g. "3.19.0" for "3.19.0_alpha20231219",
+// or "edge" if VERSION_ID doesn't contain release
+func alpineEdgeVersion(version string) string {
+	if i := strings.Index(version, "_"); i > 0 {
+		return version[:i]
+	}
+	if version == "" || !isDigit(version[0]) {
+		return "edge"
+	}
+	return version
+}
+
+// CodenameVersions maps Debian and Ubuntu codenames to versions expected by Vulners
+var CodenameVersions = map[string]string{
+	"jessie":   "8",
+	"stretch":  "9",
+	"buster":   "10",
+	"bullseye": "11",
+	"bookworm": "12",
+	"trixie":   "13",
+	"xenial":   "16.04",
+	"bionic":   "18.04",
+	"focal":    "20.04",
+	"jammy":    "22.04",
+	"noble":    "24.04",
+}
+
+// codenameVersion returns version for codename, unknown codename is returned as is
+func codenameVersion(codename string) string {
+	if v, ok := CodenameVersions[strings.ToLower(codename)]; ok {
+		return v
+	}
+	return codename
+}
+
+// GetPrettyName returns PRETTY_NAME from content of /etc/os-release for display,
+// e.g. "Ubuntu 20.04.6 LTS", or ID and VERSION_ID if it's absent
+func GetPrettyName(text string) string {
+	info := parseOSRelease(text)
+	if info["PRETTY_NAME"] != "" {
+		return info["PRETTY_NAME"]
+	}
+	return strings.TrimSpace(info["ID"] + " " + info["VERSION_ID"])
+}
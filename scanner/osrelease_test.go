@@ -0,0 +1,132 @@
+package scanner
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// readOSRelease returns content of os-release fixture from testdata/os-release
+func readOSRelease(t *testing.T, name string) string {
+	t.Helper()
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "os-release", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestCheckOSMatchesIDAndIDLike(t *testing.T) {
+	// URLs contain "search" and "archive", they shouldn't be detected as Arch Linux
+	text := "ID=pureos\nID_LIKE=debian\nHOME_URL=\"https://search.pureos.example/archive\"\n"
+	if !CheckOS(text, UbuntuOS) {
+		t.Error("derivative of Debian should be detected with ID_LIKE")
+	}
+	if CheckOS(text, ArchOS) {
+		t.Error("words of URLs shouldn't be matched")
+	}
+	if !CheckOS(readOSRelease(t, "arch"), ArchOS) {
+		t.Error("Arch Linux should be detected")
+	}
+	if !CheckOS("debian", UbuntuOS) || CheckOS("debian-slim", UbuntuOS) {
+		t.Error("OS ID should be matched exactly")
+	}
+}
+
+func TestOpenSUSEDetection(t *testing.T) {
+	text := readOSRelease(t, "opensuse-leap")
+	if !CheckOS(text, CentOS) {
+		t.Error("openSUSE should be detected as RPM-based")
+	}
+	if CheckOS(text, UbuntuOS) {
+		t.Error("openSUSE shouldn't be detected as Debian-based")
+	}
+
+	name, version := GetOSNameAndVersion(text)
+	if name != "opensuse-leap" || version != "15.5" {
+		t.Errorf("GetOSNameAndVersion() = %q, %q, want opensuse-leap, 15.5", name, version)
+	}
+	if got := VulnersOSName(name); got != "opensuse" {
+		t.Errorf("VulnersOSName(%q) = %q, want opensuse", name, got)
+	}
+	if got := VulnersOSName("sles"); got != "suse" {
+		t.Errorf("VulnersOSName(sles) = %q, want suse", got)
+	}
+}
+
+func TestGetOSNameAndVersion(t *testing.T) {
+	tests := []struct {
+		fixture string
+		name    string
+		version string
+		pretty  string
+	}{
+		{"alpine", "alpine", "3.18.4", "Alpine Linux v3.18"},
+		{"arch", "arch", "", "Arch Linux"},
+		{"ubuntu", "ubuntu", "20.04", "Ubuntu 20.04.6 LTS"},
+	}
+	for _, tt := range tests {
+		text := readOSRelease(t, tt.fixture)
+		name, version := GetOSNameAndVersion(text)
+		if name != tt.name || version != tt.version {
+			t.Errorf("%s: GetOSNameAndVersion() = %q, %q, want %q, %q", tt.fixture, name, version, tt.name, tt.version)
+		}
+		if got := GetPrettyName(text); got != tt.pretty {
+			t.Errorf("%s: GetPrettyName() = %q, want %q", tt.fixture, got, tt.pretty)
+		}
+	}
+}
+
+func TestParseOSReleaseMalformed(t *testing.T) {
+	info := parseOSRelease(readOSRelease(t, "malformed"))
+	// Lines without key are skipped and unterminated quote takes the rest of file
+	if _, ok := info["ID"]; ok {
+		t.Errorf("ID = %q, want it absent", info["ID"])
+	}
+	if want := "Broken\nVERSION_ID=1\n"; info["NAME"] != want {
+		t.Errorf("NAME = %q, want %q", info["NAME"], want)
+	}
+	if len(info) != 1 {
+		t.Errorf("parseOSRelease() = %v, want only NAME", info)
+	}
+
+	name, version := GetOSNameAndVersion("")
+	if name != "" || version != "" {
+		t.Errorf("GetOSNameAndVersion(\"\") = %q, %q, want empty strings", name, version)
+	}
+}
+
+func TestParseOSReleaseQuoting(t *testing.T) {
+	info := parseOSRelease("ID='debian'\nNAME=\"Debian \\\"GNU\\\"/Linux\"\r\nVERSION_ID=\"12\"\n")
+	if info["ID"] != "debian" || info["NAME"] != `Debian "GNU"/Linux` || info["VERSION_ID"] != "12" {
+		t.Errorf("parseOSRelease() = %v", info)
+	}
+}
+
+func TestAmazonLinux2Detection(t *testing.T) {
+	text := readOSRelease(t, "amzn2")
+	if !CheckOS(text, CentOS) {
+		t.Error("Amazon Linux 2 should be detected as RPM-based")
+	}
+
+	name, version := GetOSNameAndVersion(text)
+	if name != "amzn" || version != "2" {
+		t.Errorf("GetOSNameAndVersion() = %q, %q, want amzn, 2", name, version)
+	}
+	if got := VulnersOSName(name); got != "amazon linux" {
+		t.Errorf("VulnersOSName(%q) = %q, want amazon linux", name, got)
+	}
+}
+
+func TestDebianWithoutVersionID(t *testing.T) {
+	name, version := GetOSNameAndVersion(readOSRelease(t, "debian-slim"))
+	if name != "debian" || version != "12" {
+		t.Errorf("GetOSNameAndVersion() = %q, %q, want debian, 12", name, version)
+	}
+
+	// Unknown codename is used as is
+	name, version = GetOSNameAndVersion("ID=debian\nVERSION_CODENAME=forky\n")
+	if name != "debian" || version != "forky" {
+		t.Errorf("GetOSNameAndVersion() = %q, %q, want debian, forky", name, version)
+	}
+}
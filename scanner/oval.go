@@ -0,0 +1,194 @@
+package scanner
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// OVALOSNames contains OS supported by OVALClient
+var OVALOSNames = []string{"debian", "ubuntu"}
+
+// ovalFile contains parts of OVAL definitions file used for matching of dpkg packages
+type ovalFile struct {
+	Definitions []ovalDefinition `xml:"definitions>definition"`
+	Tests       []ovalTest       `xml:"tests>dpkginfo_test"`
+	Objects     []ovalObject     `xml:"objects>dpkginfo_object"`
+	States      []ovalState      `xml:"states>dpkginfo_state"`
+}
+
+type ovalDefinition struct {
+	ID         string `xml:"id,attr"`
+	Title      string `xml:"metadata>title"`
+	References []struct {
+		Source string `xml:"source,attr"`
+		RefID  string `xml:"ref_id,attr"`
+	} `xml:"metadata>reference"`
+	Criteria ovalCriteria `xml:"criteria"`
+}
+
+type ovalCriteria struct {
+	Criteria  []ovalCriteria `xml:"criteria"`
+	Criterion []struct {
+		TestRef string `xml:"test_ref,attr"`
+	} `xml:"criterion"`
+}
+
+type ovalTest struct {
+	ID     string `xml:"id,attr"`
+	Object struct {
+		Ref string `xml:"object_ref,attr"`
+	} `xml:"object"`
+	State struct {
+		Ref string `xml:"state_ref,attr"`
+	} `xml:"state"`
+}
+
+type ovalObject struct {
+	ID   string `xml:"id,attr"`
+	Name string `xml:"name"`
+}
+
+type ovalState struct {
+	ID  string `xml:"id,attr"`
+	Evr struct {
+		Value     string `xml:",chardata"`
+		Operation string `xml:"operation,attr"`
+	} `xml:"evr"`
+}
+
+// ovalCheck means that package is vulnerable if its version is less than Fixed
+type ovalCheck struct {
+	Definition *ovalDefinition
+	Fixed      string
+}
+
+// OVALClient is Client that matches Debian and Ubuntu packages against downloaded OVAL definitions,
+// e.g. https://www.debian.org/security/oval/oval-definitions-bullseye.xml. Only tests that compare
+// package version with "less than" are used, other criteria like OS version aren't checked,
+// so definitions should be downloaded for OS of scanned containers. OVAL doesn't contain CVSS scores.
+type OVALClient struct {
+	checks map[string][]ovalCheck
+}
+
+// LoadOVAL reads OVAL definitions for dpkg packages from file
+func LoadOVAL(path string) (*OVALClient, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var file ovalFile
+	if err := xml.NewDecoder(f).Decode(&file); err != nil {
+		return nil, fmt.Errorf("can't parse OVAL definitions %s: %v", path, err)
+	}
+
+	objects := make(map[string]string)
+	for _, v := range file.Objects {
+		objects[v.ID] = strings.TrimSpace(v.Name)
+	}
+	states := make(map[string]string)
+	for _, v := range file.States {
+		if v.Evr.Operation == "less than" {
+			states[v.ID] = strings.TrimSpace(v.Evr.Value)
+		}
+	}
+	tests := make(map[string]ovalTest)
+	for _, v := range file.Tests {
+		tests[v.ID] = v
+	}
+
+	client := &OVALClient{checks: make(map[string][]ovalCheck)}
+	for i := range file.Definitions {
+		def := &file.Definitions[i]
+		for _, ref := range def.Criteria.testRefs() {
+			test, ok := tests[ref]
+			if !ok {
+				continue
+			}
+			name, fixed := objects[test.Object.Ref], states[test.State.Ref]
+			if name == "" || fixed == "" {
+				continue
+			}
+			client.checks[name] = append(client.checks[name], ovalCheck{Definition: def, Fixed: fixed})
+		}
+	}
+	return client, nil
+}
+
+// cves returns CVE referenced by definition
+func (d *ovalDefinition) cves() []string {
+	var result []string
+	for _, ref := range d.References {
+		if ref.Source == "CVE" {
+			result = append(result, ref.RefID)
+		}
+	}
+	return result
+}
+
+// testRefs returns references to tests of all nested criteria
+func (c ovalCriteria) testRefs() []string {
+	var result []string
+	for _, v := range c.Criterion {
+		result = append(result, v.TestRef)
+	}
+	for _, v := range c.Criteria {
+		result = append(result, v.testRefs()...)
+	}
+	return result
+}
+
+// GetVulnerabilities matches packages in format "name version arch" against OVAL definitions.
+// Definitions list source packages, so source of package is used if it's known.
+func (c *OVALClient) GetVulnerabilities(ctx context.Context, rb *RequestBody) (*Vulnerabilities, error) {
+	if !CheckOS(rb.Os, OVALOSNames) {
+		return nil, fmt.Errorf("offline database supports only %s, OS is %s", strings.Join(OVALOSNames, " and "), rb.Os)
+	}
+
+	result := &Vulnerabilities{}
+	seen := make(map[string]bool)
+	matched := make(map[string]bool)
+	for _, pkg := range rb.Package {
+		fields := strings.Fields(pkg)
+		if len(fields) < 2 {
+			continue
+		}
+		name, version := fields[0], fields[1]
+		srcName, srcVersion := name, version
+		if src := strings.Fields(rb.Sources[pkg]); len(src) == 2 {
+			srcName, srcVersion = src[0], src[1]
+		}
+		for _, check := range c.checks[srcName] {
+			if compareDebVersion(srcVersion, check.Fixed) >= 0 {
+				continue
+			}
+			def := check.Definition
+			if matched[def.ID+" "+pkg] {
+				continue
+			}
+			matched[def.ID+" "+pkg] = true
+			result.Bulletins = append(result.Bulletins, def.ID)
+			result.Reasons = append(result.Reasons, Reason{
+				Package:         name,
+				ProvidedVersion: version,
+				BulletinVersion: check.Fixed,
+				ProvidedPackage: pkg,
+				BulletinPackage: srcName + " " + check.Fixed,
+				Operator:        "lt",
+				BulletinID:      def.ID,
+				Cvelist:         def.cves(),
+			})
+			for _, cve := range def.cves() {
+				if !seen[cve] {
+					seen[cve] = true
+					result.CVE = append(result.CVE, cve)
+				}
+			}
+		}
+	}
+	return result, nil
+}
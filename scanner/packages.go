@@ -0,0 +1,76 @@
+package scanner
+
+import "strings"
+
+// SplitPackages returns one package per line of output, empty lines and line endings are dropped
+func SplitPackages(output string) []string {
+	var result []string
+	for _, line := range strings.Split(output, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			result = append(result, line)
+		}
+	}
+	return result
+}
+
+// ParseDebPackages returns packages from output of UbuntuPackages command in format
+// "name version arch" expected by Vulners. Multi-arch qualifier like ":i386" is removed
+// from the name, since architecture is provided as a separate field.
+func ParseDebPackages(output string) []string {
+	var result []string
+	for _, line := range strings.Split(output, "\n") {
+		if pkg, _ := parseDebLine(line); pkg != "" {
+			result = append(result, pkg)
+		}
+	}
+	return result
+}
+
+// ParseDebSources returns source packages in format "name version" from output of UbuntuPackages
+// command keyed by packages returned by ParseDebPackages, lines without source are skipped
+func ParseDebSources(output string) map[string]string {
+	result := make(map[string]string)
+	for _, line := range strings.Split(output, "\n") {
+		if pkg, source := parseDebLine(line); pkg != "" && source != "" {
+			result[pkg] = source
+		}
+	}
+	return result
+}
+
+// parseDebLine returns package and its source from line in format
+// "name version arch source-name source-version", source is empty if line doesn't have it
+func parseDebLine(line string) (pkg, source string) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return "", ""
+	}
+	if i := strings.Index(fields[0], ":"); i > 0 {
+		if len(fields) < 3 {
+			fields = append(fields, fields[0][i+1:])
+		}
+		fields[0] = fields[0][:i]
+	}
+	if len(fields) > 3 {
+		if len(fields) > 4 {
+			source = fields[3] + " " + fields[4]
+		}
+		fields = fields[:3]
+	}
+	return strings.Join(fields, " "), source
+}
+
+// ParseGentooPackages returns packages in format "category/name-version" from list
+// of Portage database directories, e.g. /var/db/pkg/sys-libs/zlib-1.2.11-r4
+func ParseGentooPackages(output string) []string {
+	var result []string
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimPrefix(strings.TrimSpace(line), "/var/db/pkg/")
+		// Portage creates temporary directories while package is being merged
+		if line == "" || strings.Contains(line, "-MERGING-") {
+			continue
+		}
+		result = append(result, line)
+	}
+	return result
+}
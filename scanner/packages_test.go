@@ -0,0 +1,53 @@
+package scanner
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// readPackages returns content of package list fixture from testdata/packages
+func readPackages(t *testing.T, name string) string {
+	t.Helper()
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "packages", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestParseDebPackagesMultiArch(t *testing.T) {
+	text := readPackages(t, "dpkg-multiarch")
+	want := []string{
+		"adduser 3.118ubuntu2 all",
+		"libc6 2.31-0ubuntu9.9 amd64",
+		"libc6 2.31-0ubuntu9.9 i386",
+		"libgcc-s1 10.5.0-1ubuntu1~20.04 i386",
+		"libssl1.1 1.1.1f-1ubuntu2.19 amd64",
+		"zlib1g 1:1.2.11.dfsg-2ubuntu1.5 amd64",
+	}
+	if got := ParseDebPackages(text); !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseDebPackages() = %q, want %q", got, want)
+	}
+
+	sources := ParseDebSources(text)
+	if got := sources["libc6 2.31-0ubuntu9.9 i386"]; got != "glibc 2.31-0ubuntu9.9" {
+		t.Errorf("source of libc6:i386 = %q, want glibc 2.31-0ubuntu9.9", got)
+	}
+	if _, ok := sources["libssl1.1 1.1.1f-1ubuntu2.19 amd64"]; ok {
+		t.Error("package listed without source shouldn't have source")
+	}
+}
+
+func TestParseGentooPackages(t *testing.T) {
+	want := []string{
+		"sys-libs/zlib-1.2.13-r1",
+		"dev-libs/openssl-3.0.10",
+		"app-shells/bash-5.1_p16-r6",
+		"virtual/libc-1-r1",
+	}
+	if got := ParseGentooPackages(readPackages(t, "gentoo")); !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseGentooPackages() = %q, want %q", got, want)
+	}
+}
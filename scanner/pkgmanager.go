@@ -0,0 +1,58 @@
+package scanner
+
+import (
+	"context"
+	"sort"
+	"strings"
+)
+
+// PackageDatabases maps package manager to path of its database, they are used to detect images
+// with packages of several package managers, e.g. apk packages copied into Debian image
+var PackageDatabases = map[string]string{
+	"dpkg":   "/var/lib/dpkg/status",
+	"rpm":    "/var/lib/rpm",
+	"apk":    "/lib/apk/db/installed",
+	"pacman": "/var/lib/pacman/local",
+}
+
+// detectPackageManagers returns sorted package managers that have database in container.
+// ls exits with error if some paths don't exist, so only its output is used.
+func detectPackageManagers(cli DockerClient, ctx context.Context, id string) ([]string, error) {
+	cmd := []string{"ls", "-d"}
+	managers := make(map[string]string)
+	for k, v := range PackageDatabases {
+		cmd = append(cmd, v)
+		managers[v] = k
+	}
+	res, err := executeCmd(cli, ctx, id, cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []string
+	for _, line := range strings.Split(res.Stdout, "\n") {
+		if v, ok := managers[strings.TrimSpace(line)]; ok {
+			result = append(result, v)
+		}
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// checkPackageManager logs package manager chosen for OS and warns if container has databases
+// of other package managers, since their packages aren't checked
+func (s *Scanner) checkPackageManager(id, chosen, osName string, found []string) {
+	log := s.logger()
+	log.Debugf("Using %s to list packages of container %s because OS is %s", chosen, id, osName)
+
+	var others []string
+	for _, v := range found {
+		if v != chosen {
+			others = append(others, v)
+		}
+	}
+	if len(others) > 0 {
+		log.Warnf("Container %s has databases of several package managers (%s), only %s packages are checked because OS is %s, results may be incomplete",
+			id, strings.Join(found, ", "), chosen, osName)
+	}
+}
@@ -0,0 +1,112 @@
+package scanner
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// RequestIDHeader is header with ID of request to Vulners, it's the same for all retries of request
+// including retries of rate limited requests by AuditClient
+const RequestIDHeader = "X-Request-Id"
+
+// newRequestID returns random UUID version 4
+func newRequestID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+type contextKey int
+
+const (
+	containerIDKey contextKey = iota
+	requestIDKey
+)
+
+// WithContainerID returns context with ID of scanned container, it's written to request log
+func WithContainerID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, containerIDKey, id)
+}
+
+// ContainerIDFromContext returns ID of scanned container set with WithContainerID
+func ContainerIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(containerIDKey).(string)
+	return id
+}
+
+// withRequestID returns context with ID that HTTPAuditor uses for request instead of new one,
+// so retries of AuditClient are sent with the same ID
+func withRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// requestIDFromContext returns ID of request set with withRequestID or new ID if it isn't set
+func requestIDFromContext(ctx context.Context) string {
+	if id, ok := ctx.Value(requestIDKey).(string); ok && id != "" {
+		return id
+	}
+	return newRequestID()
+}
+
+// requestLogEntry is a line of request log
+type requestLogEntry struct {
+	Time      time.Time `json:"time"`
+	Container string    `json:"container"`
+	RequestID string    `json:"request_id"`
+	// ServerRequestID is request ID returned by Vulners if it's set
+	ServerRequestID string       `json:"server_request_id,omitempty"`
+	Status          int          `json:"status"`
+	Error           string       `json:"error,omitempty"`
+	Request         *RequestBody `json:"request,omitempty"`
+	// Software is set instead of Request for requests of language packages
+	Software *softwareRequest `json:"software,omitempty"`
+}
+
+// logRequest writes request to RequestLog with redacted API key, status is 0 if request failed without response
+func (a *HTTPAuditor) logRequest(ctx context.Context, request RequestBody, requestID, serverID string, status int, err error) {
+	if a.RequestLog == nil {
+		return
+	}
+	if request.APIKey != "" {
+		request.APIKey = "<redacted>"
+	}
+	a.writeRequestLog(ctx, requestLogEntry{RequestID: requestID, ServerRequestID: serverID, Status: status, Request: &request}, err)
+}
+
+// logSoftwareRequest writes request of software API to RequestLog like logRequest
+func (a *HTTPAuditor) logSoftwareRequest(ctx context.Context, request softwareRequest, requestID, serverID string, status int, err error) {
+	if a.RequestLog == nil {
+		return
+	}
+	if request.APIKey != "" {
+		request.APIKey = "<redacted>"
+	}
+	a.writeRequestLog(ctx, requestLogEntry{RequestID: requestID, ServerRequestID: serverID, Status: status, Software: &request}, err)
+}
+
+// writeRequestLog sets time, container and error of entry and writes it as a line of RequestLog
+func (a *HTTPAuditor) writeRequestLog(ctx context.Context, entry requestLogEntry, err error) {
+	entry.Time = time.Now().UTC()
+	entry.Container = ContainerIDFromContext(ctx)
+	if err != nil {
+		entry.Error = err.Error()
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		a.logger().Warnf("Failed to write request to request log: %v", err)
+		return
+	}
+	a.logMu.Lock()
+	defer a.logMu.Unlock()
+	if _, err := a.RequestLog.Write(append(data, '\n')); err != nil {
+		a.logger().Warnf("Failed to write request to request log: %v", err)
+	}
+}
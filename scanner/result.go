@@ -0,0 +1,286 @@
+package scanner
+
+// Vulnerabilities contains vulnerabilities found by Vulners
+type Vulnerabilities struct {
+	CVE        []string `json:"cve"`
+	Bulletins  []string `json:"bulletins"`
+	Reasons    []Reason `json:"reasons"`
+	Cvss       float64  `json:"cvss"`
+	CvssVector string   `json:"cvss_vector"`
+	// Ignored is number of findings dropped because they are listed in ignore file
+	Ignored int `json:"ignored"`
+	// SuppressedPackages contains ignored packages which reasons were dropped
+	SuppressedPackages []string `json:"suppressed_packages,omitempty"`
+	// Unfixable contains reasons without newer fixed version, they are set only if only fixable
+	// vulnerabilities are reported and aren't included in Count
+	Unfixable []Reason `json:"unfixable,omitempty"`
+}
+
+// Count returns number of found CVE and bulletins
+func (v *Vulnerabilities) Count() int {
+	return len(v.CVE) + len(v.Bulletins)
+}
+
+// merge adds vulnerabilities found for another chunk of packages as union of CVE, bulletins
+// and reasons. CVSS score is the maximum of both, since Vulners returns the maximum score for request.
+func (v *Vulnerabilities) merge(other *Vulnerabilities) {
+	for _, cve := range other.CVE {
+		if !containsString(v.CVE, cve) {
+			v.CVE = append(v.CVE, cve)
+		}
+	}
+	for _, id := range other.Bulletins {
+		if !containsString(v.Bulletins, id) {
+			v.Bulletins = append(v.Bulletins, id)
+		}
+	}
+	for _, r := range other.Reasons {
+		if !containsReason(v.Reasons, r) {
+			v.Reasons = append(v.Reasons, r)
+		}
+	}
+	if other.Cvss > v.Cvss || v.CvssVector == "" && other.Cvss == v.Cvss {
+		v.Cvss, v.CvssVector = other.Cvss, other.CvssVector
+	}
+}
+
+// applyThreshold drops vulnerabilities if their CVSS score is below min.
+// Vulners audit returns only one aggregated CVSS score for all reasons in response,
+// so threshold is applied to that score and all reasons are either kept or dropped.
+func (v *Vulnerabilities) applyThreshold(min float64) {
+	if v.Cvss < min {
+		v.CVE = nil
+		v.Bulletins = nil
+		v.Reasons = nil
+		v.Unfixable = nil
+	}
+}
+
+// applyFixable moves reasons without fixed version newer than provided one to Unfixable.
+// CVE are dropped only if all reasons that list them are unfixable.
+func (v *Vulnerabilities) applyFixable(osName string) {
+	fixedCVE := make(map[string]bool)
+	unfixableCVE := make(map[string]bool)
+	var bulletins []string
+	var reasons []Reason
+	for _, r := range v.Reasons {
+		if r.BulletinVersion == "" || compareVersion(osName, r.BulletinVersion, r.ProvidedVersion) <= 0 {
+			v.Unfixable = append(v.Unfixable, r)
+			for _, id := range r.Cvelist {
+				unfixableCVE[id] = true
+			}
+			continue
+		}
+		bulletins = append(bulletins, r.BulletinID)
+		reasons = append(reasons, r)
+		for _, id := range r.Cvelist {
+			fixedCVE[id] = true
+		}
+	}
+
+	var cve []string
+	for _, id := range v.CVE {
+		if unfixableCVE[id] && !fixedCVE[id] {
+			continue
+		}
+		cve = append(cve, id)
+	}
+	v.CVE, v.Bulletins, v.Reasons = cve, bulletins, reasons
+}
+
+// applyIgnored drops CVE and bulletins with ignored IDs and counts them in Ignored
+func (v *Vulnerabilities) applyIgnored(ignored map[string]bool) {
+	if len(ignored) == 0 {
+		return
+	}
+
+	var cve []string
+	for _, id := range v.CVE {
+		if ignored[id] {
+			v.Ignored++
+			continue
+		}
+		cve = append(cve, id)
+	}
+
+	var bulletins []string
+	var reasons []Reason
+	for _, r := range v.Reasons {
+		if ignored[r.BulletinID] {
+			v.Ignored++
+			continue
+		}
+		bulletins = append(bulletins, r.BulletinID)
+		reasons = append(reasons, r)
+	}
+	v.CVE, v.Bulletins, v.Reasons = cve, bulletins, reasons
+}
+
+// applyIgnoredPackages drops reasons of ignored packages and CVE that were listed only by them.
+// CVE that aren't linked to reasons are dropped only if all reasons were dropped.
+func (v *Vulnerabilities) applyIgnoredPackages(ignored map[string]bool) {
+	if len(ignored) == 0 {
+		return
+	}
+
+	keptCVE := make(map[string]bool)
+	droppedCVE := make(map[string]bool)
+	var bulletins []string
+	var reasons []Reason
+	for _, r := range v.Reasons {
+		if ignored[r.Package] {
+			if !containsString(v.SuppressedPackages, r.Package) {
+				v.SuppressedPackages = append(v.SuppressedPackages, r.Package)
+			}
+			for _, id := range r.Cvelist {
+				droppedCVE[id] = true
+			}
+			continue
+		}
+		bulletins = append(bulletins, r.BulletinID)
+		reasons = append(reasons, r)
+		for _, id := range r.Cvelist {
+			keptCVE[id] = true
+		}
+	}
+	if len(reasons) == len(v.Reasons) {
+		return
+	}
+
+	var cve []string
+	for _, id := range v.CVE {
+		if keptCVE[id] || !droppedCVE[id] && len(reasons) > 0 {
+			cve = append(cve, id)
+		}
+	}
+	v.CVE, v.Bulletins, v.Reasons = cve, bulletins, reasons
+}
+
+// CVEFinding is CVE with packages that caused it
+type CVEFinding struct {
+	CVE string `json:"cve"`
+	// Packages are in form "name version". Audit API doesn't return CVE of reasons, so packages
+	// are empty for its results unless all reasons belong to one bulletin.
+	Packages []string `json:"packages"`
+}
+
+// GroupByCVE returns every CVE once with packages of reasons that list it. If no reason lists CVE
+// and all reasons belong to one bulletin, all CVE are caused by packages of that bulletin.
+func (v *Vulnerabilities) GroupByCVE() []CVEFinding {
+	packages := make(map[string][]string)
+	linked := false
+	for _, r := range v.Reasons {
+		pkg := r.Package + " " + r.ProvidedVersion
+		for _, cve := range r.Cvelist {
+			linked = true
+			if !containsString(packages[cve], pkg) {
+				packages[cve] = append(packages[cve], pkg)
+			}
+		}
+	}
+	if !linked && singleBulletin(v.Reasons) {
+		for _, r := range v.Reasons {
+			pkg := r.Package + " " + r.ProvidedVersion
+			for _, cve := range v.CVE {
+				if !containsString(packages[cve], pkg) {
+					packages[cve] = append(packages[cve], pkg)
+				}
+			}
+		}
+	}
+
+	var result []CVEFinding
+	seen := make(map[string]bool)
+	for _, cve := range v.CVE {
+		if seen[cve] {
+			continue
+		}
+		seen[cve] = true
+		result = append(result, CVEFinding{CVE: cve, Packages: packages[cve]})
+	}
+	return result
+}
+
+// singleBulletin checks if there are reasons and all of them belong to the same bulletin
+func singleBulletin(reasons []Reason) bool {
+	for _, r := range reasons {
+		if r.BulletinID != reasons[0].BulletinID {
+			return false
+		}
+	}
+	return len(reasons) > 0
+}
+
+// containsReason checks if list has reason for the same bulletin and package
+func containsReason(list []Reason, r Reason) bool {
+	for _, v := range list {
+		if v.BulletinID == r.BulletinID && v.ProvidedPackage == r.ProvidedPackage {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// ContainerResult contains result of scan for a container
+type ContainerResult struct {
+	ID string `json:"id"`
+	// Names are names of container without leading slash
+	Names []string `json:"names,omitempty"`
+	Image string   `json:"image"`
+	// Service is service that container belongs to, e.g. Compose service, if it's known
+	Service string `json:"service,omitempty"`
+	// Context is name of Docker CLI context the container was scanned in, if it's set
+	Context string `json:"context,omitempty"`
+	OS      string `json:"os"`
+	Version string `json:"version"`
+	// PrettyName is name of OS for display, it isn't sent to Vulners
+	PrettyName string `json:"pretty_name,omitempty"`
+	// PackageCount is number of packages detected in container
+	PackageCount int `json:"package_count"`
+	// TruncatedPackages is number of packages that weren't checked because of package limit
+	TruncatedPackages int `json:"truncated_packages,omitempty"`
+	// Requests is number of requests to Vulners if packages were split because of package limit
+	Requests int `json:"requests,omitempty"`
+	// ExecLatencyMs is time spent on commands executed in container to detect OS and packages
+	ExecLatencyMs int64 `json:"exec_latency_ms"`
+	// VulnersLatencyMs is time spent on request to Vulners including retries
+	VulnersLatencyMs int64 `json:"vulners_latency_ms"`
+	// Findings contains CVE grouped with packages that caused them
+	Findings []CVEFinding `json:"findings,omitempty"`
+	// Languages contains vulnerabilities of language packages if they are scanned
+	Languages []LangResult `json:"languages,omitempty"`
+	// Request is set only for dry run instead of vulnerabilities, it's the first request if packages are split
+	Request *RequestBody `json:"request,omitempty"`
+	// RequestChunks contains all requests of dry run if packages are split because of package limit
+	RequestChunks []*RequestBody `json:"request_chunks,omitempty"`
+	Vulnerabilities
+}
+
+// Count returns number of findings of OS packages and language packages of container
+func (r *ContainerResult) Count() int {
+	n := r.Vulnerabilities.Count()
+	for i := range r.Languages {
+		n += r.Languages[i].Count()
+	}
+	return n
+}
+
+// MaxCvss returns the highest CVSS score of OS packages and language packages of container
+func (r *ContainerResult) MaxCvss() float64 {
+	score := r.Cvss
+	for _, lang := range r.Languages {
+		if lang.Count() > 0 && lang.Cvss > score {
+			score = lang.Cvss
+		}
+	}
+	return score
+}
@@ -0,0 +1,49 @@
+package scanner
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGroupByCVE(t *testing.T) {
+	v := &Vulnerabilities{
+		CVE: []string{"CVE-3", "CVE-1", "CVE-2"},
+		Reasons: []Reason{
+			{Package: "openssl", ProvidedVersion: "1.1.1", BulletinID: "DSA-1", Cvelist: []string{"CVE-1", "CVE-3"}},
+			{Package: "libssl", ProvidedVersion: "1.1.1", BulletinID: "DSA-1", Cvelist: []string{"CVE-1"}},
+		},
+	}
+	want := []CVEFinding{
+		{CVE: "CVE-3", Packages: []string{"openssl 1.1.1"}},
+		{CVE: "CVE-1", Packages: []string{"openssl 1.1.1", "libssl 1.1.1"}},
+		{CVE: "CVE-2"},
+	}
+	if got := v.GroupByCVE(); !reflect.DeepEqual(got, want) {
+		t.Errorf("GroupByCVE() = %+v, want %+v", got, want)
+	}
+}
+
+func TestGroupByCVEWithoutCvelist(t *testing.T) {
+	// Audit API returns CVE only for the whole request
+	v := &Vulnerabilities{
+		CVE: []string{"CVE-1", "CVE-2"},
+		Reasons: []Reason{
+			{Package: "openssl", ProvidedVersion: "1.1.1", BulletinID: "DSA-1"},
+			{Package: "libssl", ProvidedVersion: "1.1.1", BulletinID: "DSA-1"},
+		},
+	}
+	want := []CVEFinding{
+		{CVE: "CVE-1", Packages: []string{"openssl 1.1.1", "libssl 1.1.1"}},
+		{CVE: "CVE-2", Packages: []string{"openssl 1.1.1", "libssl 1.1.1"}},
+	}
+	if got := v.GroupByCVE(); !reflect.DeepEqual(got, want) {
+		t.Errorf("GroupByCVE() of one bulletin = %+v, want %+v", got, want)
+	}
+
+	v.Reasons = append(v.Reasons, Reason{Package: "zlib", ProvidedVersion: "1.2", BulletinID: "DSA-2"})
+	for _, f := range v.GroupByCVE() {
+		if len(f.Packages) != 0 {
+			t.Errorf("%s has packages %q, CVE of several bulletins can't be linked", f.CVE, f.Packages)
+		}
+	}
+}
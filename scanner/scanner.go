@@ -0,0 +1,413 @@
+// Package scanner detects OS and packages of Docker containers and checks them for known vulnerabilities on vulners.com
+package scanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+)
+
+var (
+	OSVersion      = []string{"cat", "/etc/os-release"}
+	LSBRelease     = []string{"cat", "/etc/lsb-release"}
+	RedHatRelease  = []string{"cat", "/etc/redhat-release"}
+	UbuntuPackages = []string{"dpkg-query", "-W", "-f=${Package} ${Version} ${Architecture} ${source:Package} ${source:Version}\n"}
+	CentOSPackages = []string{"rpm", "-qa"}
+	AlpinePackages = []string{"apk", "-v", "info"}
+	ArchPackages   = []string{"pacman", "-Q"}
+	GentooPackages = []string{"find", "/var/db/pkg", "-mindepth", "2", "-maxdepth", "2", "-type", "d"}
+	UbuntuOS       = []string{"debian", "ubuntu", "kali"}
+	CentOS         = []string{"rhel", "centos", "oraclelinux", "suse", "fedora", "amzn", "amazonlinux", "rocky", "almalinux"}
+	AlpineOS       = []string{"alpine"}
+	ArchOS         = []string{"arch", "manjaro"}
+	GentooOS       = []string{"gentoo"}
+)
+
+// VulnersOSNames maps OS ID from os-release to OS name expected by Vulners if they are different.
+// Rocky Linux and AlmaLinux have own advisories in Vulners, so their IDs are sent as is.
+var VulnersOSNames = map[string]string{
+	"arch":    "archlinux",
+	"manjaro": "archlinux",
+	// SUSE family is detected as RPM-based and listed with rpm -qa
+	"opensuse-leap":       "opensuse",
+	"opensuse-tumbleweed": "opensuse",
+	"sles":                "suse",
+	// Amazon Linux 1 and 2 use ID amzn, Vulners calls them "amazon linux"
+	"amzn":        "amazon linux",
+	"amazonlinux": "amazon linux",
+}
+
+// ComposeProjectLabel and ComposeServiceLabel are labels that Docker Compose sets on containers
+const (
+	ComposeProjectLabel = "com.docker.compose.project"
+	ComposeServiceLabel = "com.docker.compose.service"
+)
+
+// SwarmServiceLabel is label that Docker Swarm sets on task containers of service
+const SwarmServiceLabel = "com.docker.swarm.service.name"
+
+// ErrUnsupported is returned if container can't be scanned, e.g. Windows container or unknown OS
+var ErrUnsupported = errors.New("unsupported container")
+
+// ErrNoPackages is returned if no packages were detected, so there is nothing to check with Vulners
+var ErrNoPackages = errors.New("no packages detected")
+
+// Client checks packages for known vulnerabilities
+type Client interface {
+	GetVulnerabilities(ctx context.Context, rb *RequestBody) (*Vulnerabilities, error)
+}
+
+// Logger receives messages about the scan, e.g. output of commands executed in containers
+type Logger interface {
+	Debugf(format string, v ...interface{})
+	Infof(format string, v ...interface{})
+	Warnf(format string, v ...interface{})
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Debugf(format string, v ...interface{}) {}
+func (nopLogger) Infof(format string, v ...interface{})  {}
+func (nopLogger) Warnf(format string, v ...interface{})  {}
+
+// Scanner scans containers and checks their packages with Vulners
+type Scanner struct {
+	Docker  DockerClient
+	Vulners Client
+	// MinCVSS drops vulnerabilities with CVSS score below threshold
+	MinCVSS float64
+	// Ignored contains CVE and bulletin IDs that shouldn't be reported
+	Ignored map[string]bool
+	// IgnoredPackages contains names of packages which findings shouldn't be reported
+	IgnoredPackages map[string]bool
+	// DryRun makes scanner return request to Vulners in result instead of sending it
+	DryRun bool
+	// ShowPackages makes scanner log list of packages before it's sent to Vulners
+	ShowPackages bool
+	// Gentoo enables scanning of Gentoo containers, Vulners support for Gentoo is limited
+	Gentoo bool
+	// ScanLang makes scanner check pip, npm and gem packages in container with Software client
+	ScanLang bool
+	// Software checks language packages, it's required if ScanLang is set
+	Software SoftwareClient
+	// MaxPackages limits number of packages in one request to Vulners, 0 means no limit.
+	// Larger lists are split into several requests or truncated if TruncatePackages is set.
+	MaxPackages      int
+	TruncatePackages bool
+	// OnlyFixable makes scanner report only reasons with fixed version newer than installed one,
+	// other reasons are moved to Unfixable
+	OnlyFixable bool
+	Log         Logger
+}
+
+// New creates scanner that uses Docker client to inspect containers and Vulners client to check packages.
+// Docker client can be nil if only CheckPackages is used.
+func New(docker DockerClient, vulners Client) *Scanner {
+	return &Scanner{
+		Docker:  docker,
+		Vulners: vulners,
+		Log:     nopLogger{},
+	}
+}
+
+func (s *Scanner) logger() Logger {
+	if s.Log == nil {
+		return nopLogger{}
+	}
+	return s.Log
+}
+
+// ScanContainer scans running container with provided ID or name
+func (s *Scanner) ScanContainer(ctx context.Context, id string) (*ContainerResult, error) {
+	info, err := s.Docker.ContainerInspect(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if info.State == nil || !info.State.Running {
+		return nil, fmt.Errorf("container %s isn't running, only running containers can be scanned", id)
+	}
+
+	container := types.Container{ID: info.ID, Names: []string{info.Name}, ImageID: info.Image}
+	// Config can be absent in responses of some Docker API implementations
+	if info.Config != nil {
+		container.Image = info.Config.Image
+		container.Labels = info.Config.Labels
+	}
+	return s.Scan(ctx, container)
+}
+
+// Scan detects OS and packages of container and returns found vulnerabilities
+func (s *Scanner) Scan(ctx context.Context, container types.Container) (*ContainerResult, error) {
+	log := s.logger()
+	var execTime time.Duration
+	info, err := s.Docker.ContainerInspect(ctx, container.ID)
+	if err != nil {
+		return nil, err
+	}
+	// Commands for Linux can't be executed in Windows containers
+	if strings.EqualFold(info.Platform, "windows") {
+		return nil, fmt.Errorf("%w: Windows containers are not supported", ErrUnsupported)
+	}
+
+	run := func(cmd []string) (string, error) {
+		start := time.Now()
+		res, err := executeCmd(s.Docker, ctx, container.ID, cmd)
+		execTime += time.Since(start)
+		if err != nil {
+			return "", err
+		}
+		log.Debugf("Command %q in container %s returned: %s", strings.Join(cmd, " "), container.ID, res.Stdout)
+		if res.Stderr != "" {
+			log.Debugf("Command %q in container %s wrote to stderr: %s", strings.Join(cmd, " "), container.ID, res.Stderr)
+		}
+		if isMissingCommand(res) {
+			return "", fmt.Errorf("command %q: %w", strings.Join(cmd, " "), errMissingCommand)
+		}
+		if res.ExitCode != 0 {
+			return "", fmt.Errorf("command %q exited with code %d: %s", strings.Join(cmd, " "), res.ExitCode, strings.TrimSpace(res.Stderr))
+		}
+		return res.Stdout, nil
+	}
+
+	osver, err := detectOS(run)
+	if errors.Is(err, errMissingCommand) {
+		return nil, fmt.Errorf("%w: container appears to be distroless/minimal; cannot enumerate packages", ErrUnsupported)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	managers, err := detectPackageManagers(s.Docker, ctx, container.ID)
+	execTime += time.Since(start)
+	if err != nil {
+		log.Debugf("Can't detect package managers of container %s: %v", container.ID, err)
+	}
+
+	var pkgs []string
+	var sources map[string]string
+	var manager string
+	if CheckOS(osver, UbuntuOS) {
+		manager = "dpkg"
+		temp, err := run(UbuntuPackages)
+		if err != nil {
+			return nil, err
+		}
+		pkgs = ParseDebPackages(temp)
+		sources = ParseDebSources(temp)
+	} else if CheckOS(osver, CentOS) {
+		manager = "rpm"
+		temp, err := run(CentOSPackages)
+		if err != nil {
+			return nil, err
+		}
+		pkgs = SplitPackages(temp)
+	} else if CheckOS(osver, AlpineOS) {
+		if IsAlpineEdge(osver) {
+			log.Warnf("Container %s runs Alpine edge, packages aren't pinned to release, so matching with Vulners is best-effort", container.ID)
+		}
+		manager = "apk"
+		temp, err := run(AlpinePackages)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range SplitPackages(temp) {
+			if !strings.Contains(v, "WARNING") {
+				pkgs = append(pkgs, v)
+			}
+		}
+	} else if CheckOS(osver, ArchOS) {
+		manager = "pacman"
+		temp, err := run(ArchPackages)
+		if err != nil {
+			return nil, err
+		}
+		pkgs = SplitPackages(temp)
+	} else if CheckOS(osver, GentooOS) {
+		if !s.Gentoo {
+			return nil, fmt.Errorf("%w: Gentoo is detected, but scanning of Gentoo containers isn't enabled", ErrUnsupported)
+		}
+		log.Warnf("Vulners support for Gentoo is limited, results for container %s may be incomplete", container.ID)
+		manager = "portage"
+		temp, err := run(GentooPackages)
+		if err != nil {
+			return nil, err
+		}
+		pkgs = ParseGentooPackages(temp)
+	} else {
+		return nil, fmt.Errorf("%w: can't determine type of OS or OS is not supported: %s", ErrUnsupported, osver)
+	}
+
+	name, ver := GetOSNameAndVersion(osver)
+	s.checkPackageManager(container.ID, manager, name, managers)
+	log.Debugf("Commands in container %s took %v", container.ID, execTime)
+	res, err := s.checkPackages(ctx, &ContainerResult{
+		ID:            container.ID,
+		ExecLatencyMs: execTime.Milliseconds(),
+		Names:         ContainerNames(container),
+		Image:         container.Image,
+		Service:       ContainerService(container),
+		OS:            name,
+		Version:       ver,
+		PrettyName:    GetPrettyName(osver),
+	}, pkgs, sources)
+	if err != nil || !s.ScanLang {
+		return res, err
+	}
+
+	if s.Software == nil {
+		return nil, errors.New("software client isn't set, language packages can't be checked")
+	}
+	res.Languages, err = s.scanLang(ctx, container.ID, run)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// CheckPackages sends packages to Vulners and adds found vulnerabilities to result.
+// Empty packages are dropped and ErrNoPackages is returned if nothing is left.
+func (s *Scanner) CheckPackages(ctx context.Context, res *ContainerResult, pkgs []string) (*ContainerResult, error) {
+	return s.checkPackages(ctx, res, pkgs, nil)
+}
+
+// checkPackages is CheckPackages that also passes source packages of Debian packages to client
+func (s *Scanner) checkPackages(ctx context.Context, res *ContainerResult, pkgs []string, sources map[string]string) (*ContainerResult, error) {
+	var nonEmpty []string
+	for _, v := range pkgs {
+		if v = strings.TrimSpace(v); v != "" {
+			nonEmpty = append(nonEmpty, v)
+		}
+	}
+	if len(nonEmpty) == 0 {
+		return nil, fmt.Errorf("%w for container %s", ErrNoPackages, res.ID)
+	}
+	pkgs = nonEmpty
+	if s.MaxPackages > 0 && len(pkgs) > s.MaxPackages && s.TruncatePackages {
+		s.logger().Warnf("Container %s has %d packages, only first %d are checked because of package limit", res.ID, len(pkgs), s.MaxPackages)
+		res.TruncatedPackages = len(pkgs) - s.MaxPackages
+		pkgs = pkgs[:s.MaxPackages]
+	}
+	res.PackageCount = len(pkgs)
+	if s.ShowPackages {
+		s.logger().Infof("Submitting %d packages for container %s:\n%s", len(pkgs), res.ID, strings.Join(pkgs, "\n"))
+	} else {
+		s.logger().Debugf("Submitting %d packages for container %s", len(pkgs), res.ID)
+	}
+
+	body := &RequestBody{
+		Os:      VulnersOSName(res.OS),
+		Version: res.Version,
+		Package: pkgs,
+		Sources: sources,
+	}
+	chunks := splitPackages(pkgs, s.MaxPackages)
+	if len(chunks) > 1 {
+		s.logger().Infof("Splitting %d packages of container %s into %d requests because of package limit", len(pkgs), res.ID, len(chunks))
+		res.Requests = len(chunks)
+	}
+	if s.DryRun {
+		res.Request = body
+		if len(chunks) > 1 {
+			for _, chunk := range chunks {
+				chunkBody := *body
+				chunkBody.Package = chunk
+				res.RequestChunks = append(res.RequestChunks, &chunkBody)
+			}
+			res.Request = res.RequestChunks[0]
+		}
+		return res, nil
+	}
+	start := time.Now()
+	var vulns *Vulnerabilities
+	if len(chunks) == 1 {
+		v, err := s.Vulners.GetVulnerabilities(WithContainerID(ctx, res.ID), body)
+		if err != nil {
+			return nil, err
+		}
+		vulns = v
+	} else {
+		// Parts are merged into new value, since responses can be shared with other containers
+		vulns = &Vulnerabilities{}
+		for _, chunk := range chunks {
+			chunkBody := *body
+			chunkBody.Package = chunk
+			v, err := s.Vulners.GetVulnerabilities(WithContainerID(ctx, res.ID), &chunkBody)
+			if err != nil {
+				return nil, err
+			}
+			vulns.merge(v)
+		}
+	}
+	latency := time.Since(start)
+	res.VulnersLatencyMs = latency.Milliseconds()
+	s.logger().Debugf("Vulners request for container %s took %v", res.ID, latency)
+	vulns.applyIgnored(s.Ignored)
+	vulns.applyIgnoredPackages(s.IgnoredPackages)
+	vulns.applyThreshold(s.MinCVSS)
+	if s.OnlyFixable {
+		vulns.applyFixable(res.OS)
+	}
+	res.Vulnerabilities = *vulns
+	res.Findings = res.GroupByCVE()
+	return res, nil
+}
+
+// splitPackages splits packages into chunks of at most size packages, size 0 means no limit
+func splitPackages(pkgs []string, size int) [][]string {
+	if size <= 0 || len(pkgs) <= size {
+		return [][]string{pkgs}
+	}
+	var result [][]string
+	for len(pkgs) > size {
+		result = append(result, pkgs[:size])
+		pkgs = pkgs[size:]
+	}
+	return append(result, pkgs)
+}
+
+// ContainerNames returns names of container without leading slash
+func ContainerNames(container types.Container) []string {
+	var names []string
+	for _, v := range container.Names {
+		names = append(names, strings.TrimPrefix(v, "/"))
+	}
+	return names
+}
+
+// ContainerService returns service of container from Swarm or Compose label or empty string if it isn't set
+func ContainerService(container types.Container) string {
+	if v := container.Labels[SwarmServiceLabel]; v != "" {
+		return v
+	}
+	return container.Labels[ComposeServiceLabel]
+}
+
+// VulnersOSName returns OS name expected by Vulners for OS ID from os-release
+func VulnersOSName(id string) string {
+	if v, ok := VulnersOSNames[id]; ok {
+		return v
+	}
+	return id
+}
+
+// CheckOS checks if OS is any of options. Text is OS ID or content of /etc/os-release, then ID and IDs
+// of ID_LIKE are compared with options, so derivatives match, but words of other fields like URLs don't.
+func CheckOS(text string, options []string) bool {
+	ids := []string{strings.ToLower(strings.TrimSpace(text))}
+	if info := parseOSRelease(text); info["ID"] != "" {
+		ids = append([]string{strings.ToLower(info["ID"])}, strings.Fields(strings.ToLower(info["ID_LIKE"]))...)
+	}
+	for _, id := range ids {
+		for _, v := range options {
+			if id == v {
+				return true
+			}
+		}
+	}
+	return false
+}
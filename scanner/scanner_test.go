@@ -0,0 +1,284 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+)
+
+// fakeClient is Client that records requests and returns the same vulnerabilities for all of them
+type fakeClient struct {
+	vulns    *Vulnerabilities
+	requests []*RequestBody
+}
+
+func (f *fakeClient) GetVulnerabilities(ctx context.Context, rb *RequestBody) (*Vulnerabilities, error) {
+	f.requests = append(f.requests, rb)
+	if f.vulns == nil {
+		return &Vulnerabilities{}, nil
+	}
+	return f.vulns, nil
+}
+
+func TestScanDetectsPackageManager(t *testing.T) {
+	tests := []struct {
+		fixture  string
+		cmd      []string
+		output   string
+		os       string
+		version  string
+		packages []string
+	}{
+		{
+			fixture: "ubuntu",
+			cmd:     UbuntuPackages,
+			output:  "libc6 2.31-0ubuntu9.9 amd64 glibc 2.31-0ubuntu9.9\nopenssl 1.1.1f-1ubuntu2.19 amd64 openssl 1.1.1f-1ubuntu2.19\n",
+			os:      "ubuntu",
+			version: "20.04",
+			packages: []string{
+				"libc6 2.31-0ubuntu9.9 amd64",
+				"openssl 1.1.1f-1ubuntu2.19 amd64",
+			},
+		},
+		{
+			fixture:  "centos",
+			cmd:      CentOSPackages,
+			output:   "openssl-libs-1.0.2k-25.el7_9.x86_64\nbash-4.2.46-35.el7_9.x86_64\n",
+			os:       "centos",
+			version:  "7",
+			packages: []string{"openssl-libs-1.0.2k-25.el7_9.x86_64", "bash-4.2.46-35.el7_9.x86_64"},
+		},
+		{
+			fixture:  "alpine",
+			cmd:      AlpinePackages,
+			output:   "musl-1.2.4-r2\nbusybox-1.36.1-r5\n",
+			os:       "alpine",
+			version:  "3.18.4",
+			packages: []string{"musl-1.2.4-r2", "busybox-1.36.1-r5"},
+		},
+	}
+	for _, tt := range tests {
+		cli := &fakeDocker{execs: map[string]fakeExec{
+			"cat /etc/os-release":     {stream: muxStream(readOSRelease(t, tt.fixture), "")},
+			strings.Join(tt.cmd, " "): {stream: muxStream(tt.output, "")},
+		}}
+		client := &fakeClient{vulns: &Vulnerabilities{CVE: []string{"CVE-2023-0286"}, Cvss: 7.4}}
+
+		res, err := New(cli, client).Scan(context.Background(), types.Container{ID: "c1", Names: []string{"/web"}})
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.fixture, err)
+		}
+		if res.OS != tt.os || res.Version != tt.version {
+			t.Errorf("%s: OS = %q %q, want %q %q", tt.fixture, res.OS, res.Version, tt.os, tt.version)
+		}
+		if len(client.requests) != 1 {
+			t.Fatalf("%s: client got %d requests, want 1", tt.fixture, len(client.requests))
+		}
+		rb := client.requests[0]
+		if rb.Os != tt.os || rb.Version != tt.version || !reflect.DeepEqual(rb.Package, tt.packages) {
+			t.Errorf("%s: request = %+v, want packages %q", tt.fixture, rb, tt.packages)
+		}
+		if res.PackageCount != len(tt.packages) || !reflect.DeepEqual(res.CVE, []string{"CVE-2023-0286"}) {
+			t.Errorf("%s: result = %+v", tt.fixture, res)
+		}
+		if !reflect.DeepEqual(res.Names, []string{"web"}) {
+			t.Errorf("%s: Names = %q, want web", tt.fixture, res.Names)
+		}
+	}
+}
+
+func TestScanUnsupportedOS(t *testing.T) {
+	cli := &fakeDocker{execs: map[string]fakeExec{
+		"cat /etc/os-release": {stream: muxStream("ID=plan9\nVERSION_ID=4\n", "")},
+	}}
+	client := &fakeClient{}
+
+	if _, err := New(cli, client).Scan(context.Background(), types.Container{ID: "c1"}); err == nil {
+		t.Fatal("expected error for unsupported OS")
+	}
+	if len(client.requests) != 0 {
+		t.Errorf("client got %d requests, want 0", len(client.requests))
+	}
+}
+
+func TestScanContainerWithoutConfig(t *testing.T) {
+	cli := &fakeDocker{
+		info: types.ContainerJSON{ContainerJSONBase: &types.ContainerJSONBase{
+			ID:       "c1",
+			Name:     "/web",
+			Platform: "linux",
+			State:    &types.ContainerState{Running: true},
+		}},
+		execs: map[string]fakeExec{
+			"cat /etc/os-release": {stream: muxStream(readOSRelease(t, "alpine"), "")},
+			"apk -v info":         {stream: muxStream("musl-1.2.4-r2\n", "")},
+		},
+	}
+
+	res, err := New(cli, &fakeClient{}).ScanContainer(context.Background(), "c1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if res.Image != "" || res.OS != "alpine" {
+		t.Errorf("result = %+v, want alpine without image", res)
+	}
+}
+
+func TestCheckPackagesEmptyOutput(t *testing.T) {
+	for _, output := range []string{"", "\n\n", " \r\n\t\n"} {
+		client := &fakeClient{}
+		res := &ContainerResult{ID: "c1", OS: "debian", Version: "11"}
+
+		_, err := New(nil, client).CheckPackages(context.Background(), res, SplitPackages(output))
+		if !errors.Is(err, ErrNoPackages) {
+			t.Errorf("output %q: error = %v, want ErrNoPackages", output, err)
+		}
+		if len(client.requests) != 0 {
+			t.Errorf("output %q: client got %d requests, want 0", output, len(client.requests))
+		}
+	}
+}
+
+func TestCheckPackagesDropsEmptyPackages(t *testing.T) {
+	client := &fakeClient{}
+	pkgs := []string{"", "bash 5.1-2+deb11u1 amd64", "  ", "\t", "zlib1g 1:1.2.11.dfsg-2+deb11u2 amd64 ", ""}
+
+	res, err := New(nil, client).CheckPackages(context.Background(), &ContainerResult{ID: "c1", OS: "debian", Version: "11"}, pkgs)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(client.requests) != 1 {
+		t.Fatalf("client got %d requests, want 1", len(client.requests))
+	}
+	want := []string{"bash 5.1-2+deb11u1 amd64", "zlib1g 1:1.2.11.dfsg-2+deb11u2 amd64"}
+	if got := client.requests[0].Package; !reflect.DeepEqual(got, want) {
+		t.Errorf("Package = %q, want %q", got, want)
+	}
+	if res.PackageCount != 2 {
+		t.Errorf("PackageCount = %d, want 2", res.PackageCount)
+	}
+}
+
+// chunkClient returns vulnerabilities for request based on its first package
+type chunkClient struct {
+	vulns    map[string]*Vulnerabilities
+	requests []*RequestBody
+}
+
+func (c *chunkClient) GetVulnerabilities(ctx context.Context, rb *RequestBody) (*Vulnerabilities, error) {
+	c.requests = append(c.requests, rb)
+	if v, ok := c.vulns[rb.Package[0]]; ok {
+		return v, nil
+	}
+	return &Vulnerabilities{}, nil
+}
+
+func TestSplitPackages(t *testing.T) {
+	pkgs := make([]string, 3000)
+	for i := range pkgs {
+		pkgs[i] = fmt.Sprintf("pkg%d 1.0 amd64", i)
+	}
+
+	chunks := splitPackages(pkgs, 1000)
+	if len(chunks) != 3 {
+		t.Fatalf("got %d chunks, want 3", len(chunks))
+	}
+	for i, chunk := range chunks {
+		if len(chunk) != 1000 || chunk[0] != pkgs[i*1000] {
+			t.Errorf("chunk %d has %d packages starting with %q", i, len(chunk), chunk[0])
+		}
+	}
+	if got := splitPackages(pkgs[:1001], 1000); len(got) != 2 || len(got[1]) != 1 {
+		t.Errorf("1001 packages are split into %d chunks, want 2", len(got))
+	}
+	if got := splitPackages(pkgs, 0); len(got) != 1 || len(got[0]) != 3000 {
+		t.Errorf("packages without limit are split into %d chunks, want 1", len(got))
+	}
+}
+
+func TestCheckPackagesMergesChunks(t *testing.T) {
+	pkgs := make([]string, 3000)
+	for i := range pkgs {
+		pkgs[i] = fmt.Sprintf("pkg%d 1.0 amd64", i)
+	}
+	shared := Reason{Package: "pkg0", BulletinID: "USN-1"}
+	client := &chunkClient{vulns: map[string]*Vulnerabilities{
+		pkgs[0]: {
+			CVE:       []string{"CVE-1", "CVE-2"},
+			Bulletins: []string{"USN-1"},
+			Reasons:   []Reason{shared},
+			Cvss:      5,
+		},
+		pkgs[1000]: {
+			CVE:        []string{"CVE-2", "CVE-3"},
+			Bulletins:  []string{"USN-1", "USN-2"},
+			Reasons:    []Reason{shared, {Package: "pkg1000", BulletinID: "USN-2"}},
+			Cvss:       9.8,
+			CvssVector: "AV:N/AC:L",
+		},
+		pkgs[2000]: {CVE: []string{"CVE-4"}, Cvss: 7},
+	}}
+	s := New(nil, client)
+	s.MaxPackages = 1000
+
+	res, err := s.CheckPackages(context.Background(), &ContainerResult{ID: "c1", OS: "ubuntu", Version: "22.04"}, pkgs)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(client.requests) != 3 || res.Requests != 3 {
+		t.Fatalf("got %d requests, result has %d, want 3", len(client.requests), res.Requests)
+	}
+	for i, rb := range client.requests {
+		if len(rb.Package) != 1000 || rb.Os != "ubuntu" || rb.Version != "22.04" {
+			t.Errorf("request %d = %s %s with %d packages", i, rb.Os, rb.Version, len(rb.Package))
+		}
+	}
+	if want := []string{"CVE-1", "CVE-2", "CVE-3", "CVE-4"}; !reflect.DeepEqual(res.CVE, want) {
+		t.Errorf("CVE = %v, want %v", res.CVE, want)
+	}
+	if want := []string{"USN-1", "USN-2"}; !reflect.DeepEqual(res.Bulletins, want) {
+		t.Errorf("Bulletins = %v, want %v", res.Bulletins, want)
+	}
+	if len(res.Reasons) != 2 {
+		t.Errorf("Reasons = %v, want 2 unique reasons", res.Reasons)
+	}
+	if res.Cvss != 9.8 || res.CvssVector != "AV:N/AC:L" {
+		t.Errorf("CVSS = %v %q, want maximum 9.8 with its vector", res.Cvss, res.CvssVector)
+	}
+	// Responses can be shared by cache, so they shouldn't be changed by merge
+	if len(client.vulns[pkgs[0]].CVE) != 2 {
+		t.Errorf("response of first chunk was changed: %v", client.vulns[pkgs[0]].CVE)
+	}
+}
+
+func TestCheckPackagesDryRunSplitsRequests(t *testing.T) {
+	pkgs := make([]string, 2500)
+	for i := range pkgs {
+		pkgs[i] = fmt.Sprintf("pkg%d 1.0 amd64", i)
+	}
+	client := &chunkClient{}
+	s := New(nil, client)
+	s.MaxPackages = 1000
+	s.DryRun = true
+
+	res, err := s.CheckPackages(context.Background(), &ContainerResult{ID: "c1", OS: "ubuntu", Version: "22.04"}, pkgs)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(client.requests) != 0 {
+		t.Fatalf("dry run sent %d requests", len(client.requests))
+	}
+	if res.Requests != 3 || len(res.RequestChunks) != 3 || res.Request != res.RequestChunks[0] {
+		t.Fatalf("result has %d requests and %d chunks, want 3 with the first one as Request", res.Requests, len(res.RequestChunks))
+	}
+	for i, want := range []int{1000, 1000, 500} {
+		if rb := res.RequestChunks[i]; len(rb.Package) != want || rb.Os != "ubuntu" {
+			t.Errorf("request %d = %s with %d packages, want %d", i, rb.Os, len(rb.Package), want)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package scanner
+
+import (
+	"strconv"
+	"strings"
+)
+
+// compareVersion compares package versions with rules of package manager of OS: dpkg for Debian family
+// and rpmvercmp for others, since pacman uses it too and it's close enough for apk versions
+func compareVersion(osName, a, b string) int {
+	if CheckOS(osName, UbuntuOS) {
+		return compareDebVersion(a, b)
+	}
+	return compareRPMVersion(a, b)
+}
+
+// compareDebVersion compares Debian package versions in format [epoch:]upstream[-revision]
+// like dpkg --compare-versions, result is negative if a < b, 0 if a == b and positive if a > b
+func compareDebVersion(a, b string) int {
+	ea, ua, ra := splitDebVersion(a)
+	eb, ub, rb := splitDebVersion(b)
+	if ea != eb {
+		if ea < eb {
+			return -1
+		}
+		return 1
+	}
+	if c := compareDebPart(ua, ub); c != 0 {
+		return c
+	}
+	return compareDebPart(ra, rb)
+}
+
+// splitDebVersion returns epoch, upstream version and revision of Debian version
+func splitDebVersion(v string) (int, string, string) {
+	v = strings.TrimSpace(v)
+	epoch := 0
+	if i := strings.Index(v, ":"); i > -1 {
+		epoch, _ = strconv.Atoi(v[:i])
+		v = v[i+1:]
+	}
+	var revision string
+	if i := strings.LastIndex(v, "-"); i > -1 {
+		revision = v[i+1:]
+		v = v[:i]
+	}
+	return epoch, v, revision
+}
+
+// compareRPMVersion compares RPM package versions in format [epoch:]version[-release] like rpm,
+// release is compared only if both versions have it
+func compareRPMVersion(a, b string) int {
+	ea, va, ra := splitDebVersion(a)
+	eb, vb, rb := splitDebVersion(b)
+	if ea != eb {
+		if ea < eb {
+			return -1
+		}
+		return 1
+	}
+	if c := rpmvercmp(va, vb); c != 0 || ra == "" || rb == "" {
+		return c
+	}
+	return rpmvercmp(ra, rb)
+}
+
+// rpmvercmp compares versions with algorithm of rpm: they are split into alphabetic and numeric segments,
+// numeric segments are newer than alphabetic, ~ sorts before anything and ^ sorts after end of version
+func rpmvercmp(a, b string) int {
+	if a == b {
+		return 0
+	}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		for i < len(a) && !isDigit(a[i]) && !isLetter(a[i]) && a[i] != '~' && a[i] != '^' {
+			i++
+		}
+		for j < len(b) && !isDigit(b[j]) && !isLetter(b[j]) && b[j] != '~' && b[j] != '^' {
+			j++
+		}
+
+		tildeA, tildeB := i < len(a) && a[i] == '~', j < len(b) && b[j] == '~'
+		if tildeA || tildeB {
+			if !tildeA {
+				return 1
+			}
+			if !tildeB {
+				return -1
+			}
+			i++
+			j++
+			continue
+		}
+
+		caretA, caretB := i < len(a) && a[i] == '^', j < len(b) && b[j] == '^'
+		if caretA || caretB {
+			if i >= len(a) {
+				return -1
+			}
+			if j >= len(b) {
+				return 1
+			}
+			if !caretA {
+				return 1
+			}
+			if !caretB {
+				return -1
+			}
+			i++
+			j++
+			continue
+		}
+
+		if i >= len(a) || j >= len(b) {
+			break
+		}
+
+		si, sj := i, j
+		numeric := isDigit(a[i])
+		same := isLetter
+		if numeric {
+			same = isDigit
+		}
+		for i < len(a) && same(a[i]) {
+			i++
+		}
+		for j < len(b) && same(b[j]) {
+			j++
+		}
+		segA, segB := a[si:i], b[sj:j]
+		if segB == "" {
+			if numeric {
+				return 1
+			}
+			return -1
+		}
+		if numeric {
+			segA, segB = strings.TrimLeft(segA, "0"), strings.TrimLeft(segB, "0")
+			if len(segA) != len(segB) {
+				if len(segA) < len(segB) {
+					return -1
+				}
+				return 1
+			}
+		}
+		if c := strings.Compare(segA, segB); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case i >= len(a) && j >= len(b):
+		return 0
+	case i >= len(a):
+		return -1
+	default:
+		return 1
+	}
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// debOrder returns weight of character in version: ~ sorts before anything including end of version,
+// letters sort before other characters
+func debOrder(s string, i int) int {
+	if i >= len(s) {
+		return 0
+	}
+	c := s[i]
+	switch {
+	case isDigit(c):
+		return 0
+	case isLetter(c):
+		return int(c)
+	case c == '~':
+		return -1
+	default:
+		return int(c) + 256
+	}
+}
+
+// compareDebPart compares upstream versions or revisions with algorithm of dpkg:
+// non-digit parts are compared by debOrder and digit parts are compared numerically
+func compareDebPart(a, b string) int {
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		for (i < len(a) && !isDigit(a[i])) || (j < len(b) && !isDigit(b[j])) {
+			ac, bc := debOrder(a, i), debOrder(b, j)
+			if ac != bc {
+				return ac - bc
+			}
+			i++
+			j++
+		}
+
+		for i < len(a) && a[i] == '0' {
+			i++
+		}
+		for j < len(b) && b[j] == '0' {
+			j++
+		}
+		firstDiff := 0
+		for i < len(a) && j < len(b) && isDigit(a[i]) && isDigit(b[j]) {
+			if firstDiff == 0 {
+				firstDiff = int(a[i]) - int(b[j])
+			}
+			i++
+			j++
+		}
+		if i < len(a) && isDigit(a[i]) {
+			return 1
+		}
+		if j < len(b) && isDigit(b[j]) {
+			return -1
+		}
+		if firstDiff != 0 {
+			return firstDiff
+		}
+	}
+	return 0
+}
@@ -0,0 +1,98 @@
+package scanner
+
+import "testing"
+
+// sign returns -1, 0 or 1 for result of comparison
+func sign(c int) int {
+	switch {
+	case c < 0:
+		return -1
+	case c > 0:
+		return 1
+	}
+	return 0
+}
+
+func TestCompareDebVersion(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.0", "1.0", 0},
+		{"1.0", "1.1", -1},
+		{"1.10", "1.9", 1},
+		// epoch wins over any upstream version
+		{"1:1.0", "2.0", 1},
+		{"0:1.0", "1.0", 0},
+		{"1:1.2.11.dfsg-2", "2:1.0", -1},
+		// tilde sorts before anything, even the end of version
+		{"1.0~rc1", "1.0", -1},
+		{"1.0~rc1", "1.0~rc2", -1},
+		{"1.0~~", "1.0~", -1},
+		{"10.5.0-1ubuntu1~20.04", "10.5.0-1ubuntu1", -1},
+		// letters sort before non-letters
+		{"1.0a", "1.0+", -1},
+		// revision is compared after upstream version
+		{"1.1.1f-1ubuntu2.19", "1.1.1f-1ubuntu2.2", 1},
+		{"2.31-0ubuntu9.9", "2.31-0ubuntu9.10", -1},
+		{"1.0-1", "1.0", 1},
+		{"1.0-1+deb11u1", "1.0-1", 1},
+		// hyphen in upstream version, revision starts after the last one
+		{"1.2-3-4", "1.2-3-5", -1},
+	}
+	for _, tt := range tests {
+		if got := sign(compareDebVersion(tt.a, tt.b)); got != tt.want {
+			t.Errorf("compareDebVersion(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+		if got := sign(compareDebVersion(tt.b, tt.a)); got != -tt.want {
+			t.Errorf("compareDebVersion(%q, %q) = %d, want %d", tt.b, tt.a, got, -tt.want)
+		}
+	}
+}
+
+func TestCompareRPMVersion(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.0", "1.0", 0},
+		{"1.0", "1.0.1", -1},
+		{"2.10", "2.9", 1},
+		{"1.001", "1.1", 0},
+		// epoch
+		{"1:1.0-1", "2.0-1", 1},
+		{"0:1.0-1", "1.0-1", 0},
+		// tilde sorts before and caret after the end of version
+		{"1.0~rc1", "1.0", -1},
+		{"1.0~rc1", "1.0~rc2", -1},
+		{"1.0^git1", "1.0", 1},
+		{"1.0^git1", "1.0.1", -1},
+		// numeric segment is newer than alphabetic one
+		{"1.0a", "1.0.1", -1},
+		{"2.a", "2.1", -1},
+		// release suffixes
+		{"1.0.2k-25.el7_9", "1.0.2k-24.el7_9", 1},
+		{"1.0.2k-25.el7_9", "1.0.2k-25.el7_10", -1},
+		{"3.0.7-6.el9_2", "3.0.7-16.el9_2", -1},
+		// release is compared only if both versions have it
+		{"1.0", "1.0-5", 0},
+	}
+	for _, tt := range tests {
+		if got := sign(compareRPMVersion(tt.a, tt.b)); got != tt.want {
+			t.Errorf("compareRPMVersion(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+		if got := sign(compareRPMVersion(tt.b, tt.a)); got != -tt.want {
+			t.Errorf("compareRPMVersion(%q, %q) = %d, want %d", tt.b, tt.a, got, -tt.want)
+		}
+	}
+}
+
+func TestCompareVersionByOS(t *testing.T) {
+	// "1.0a" is older than "1.0+" for dpkg and newer for rpm, which ignores separators
+	if compareVersion("debian", "1.0a", "1.0+") >= 0 {
+		t.Error("dpkg rules should be used for Debian")
+	}
+	if compareVersion("centos", "1.0a", "1.0+") <= 0 {
+		t.Error("rpm rules should be used for CentOS")
+	}
+}
@@ -0,0 +1,503 @@
+package scanner
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	// URL of Vulners audit API for DefaultFormatVersion
+	URL        = "https://vulners.com/api/v3/audit/audit/"
+	maxBackoff = 30 * time.Second
+	// DefaultUserAgent identifies library in requests to Vulners
+	DefaultUserAgent = "vulnedock"
+	// maxErrorBodySize is size of response body included in error for unsuccessful responses
+	maxErrorBodySize = 512
+)
+
+// RateLimitHeaders contains headers of Vulners response with remaining quota
+var RateLimitHeaders = []string{"X-Vulners-Ratelimit-Remaining", "X-Ratelimit-Remaining"}
+
+// RequestBody describe JSON for request
+type RequestBody struct {
+	Os      string   `json:"os"`
+	Version string   `json:"version"`
+	Package []string `json:"package"`
+	APIKey  string   `json:"apiKey,omitempty"`
+	// Sources maps Debian packages to their source packages in format "name version",
+	// it isn't sent to Vulners and is used only to match OVAL definitions
+	Sources map[string]string `json:"-"`
+}
+
+// Reason describes package that matched Vulners bulletin
+type Reason struct {
+	Package         string `json:"package"`
+	ProvidedVersion string `json:"providedVersion"`
+	BulletinVersion string `json:"bulletinVersion"`
+	ProvidedPackage string `json:"providedPackage"`
+	BulletinPackage string `json:"bulletinPackage"`
+	Operator        string `json:"operator"`
+	BulletinID      string `json:"bulletinID"`
+	// Cvelist contains CVE fixed in bulletin if Vulners returns them for reason
+	Cvelist []string `json:"cvelist,omitempty"`
+}
+
+// operators maps Vulners operators to symbols
+var operators = map[string]string{
+	"lt": "<",
+	"le": "<=",
+	"eq": "=",
+	"ge": ">=",
+	"gt": ">",
+}
+
+// String returns reason in form "libssl 1.1.0 < 1.1.1 (fixed in bulletin X)"
+func (r Reason) String() string {
+	op := r.Operator
+	if v, ok := operators[op]; ok {
+		op = v
+	}
+	return fmt.Sprintf("%s %s %s %s (fixed in bulletin %s)", r.Package, r.ProvidedVersion, op, r.BulletinVersion, r.BulletinID)
+}
+
+// Upgrade returns reason in form "upgrade libssl from 1.1.0 to 1.1.1 (fixed in bulletin X)".
+// Versions are compared with rules of package manager of OS, so if fixed version isn't newer
+// than provided one, e.g. Vulners uses other operator than "lt", reason is returned as String does.
+func (r Reason) Upgrade(osName string) string {
+	if r.BulletinVersion == "" || compareVersion(osName, r.BulletinVersion, r.ProvidedVersion) <= 0 {
+		return r.String()
+	}
+	return fmt.Sprintf("upgrade %s from %s to %s (fixed in bulletin %s)", r.Package, r.ProvidedVersion, r.BulletinVersion, r.BulletinID)
+}
+
+// VulnersErrorKind describes what caused error returned by Vulners
+type VulnersErrorKind int
+
+const (
+	// ErrorUnknown is any error that isn't recognized
+	ErrorUnknown VulnersErrorKind = iota
+	// ErrorRateLimited means that request quota is exceeded, request can be retried later
+	ErrorRateLimited
+	// ErrorInvalidOS means that OS or its version isn't supported by Vulners
+	ErrorInvalidOS
+	// ErrorBadRequest means that request is invalid, e.g. API key is wrong
+	ErrorBadRequest
+)
+
+var osWordRegexp = regexp.MustCompile(`\bos\b`)
+
+// VulnersError is returned if Vulners responded with error
+type VulnersError struct {
+	Code    int
+	Message string
+	Kind    VulnersErrorKind
+	// RetryAfter is delay requested by Retry-After header of 429 response
+	RetryAfter time.Duration
+}
+
+// newVulnersError creates error for code and message from Vulners response.
+// Vulners doesn't document values of errorCode, so kind of error is detected by message.
+func newVulnersError(code int, message string) *VulnersError {
+	kind := ErrorUnknown
+	msg := strings.ToLower(message)
+	switch {
+	case strings.Contains(msg, "rate limit") || strings.Contains(msg, "too many requests") || strings.Contains(msg, "exceeded"):
+		kind = ErrorRateLimited
+	case osWordRegexp.MatchString(msg) && (strings.Contains(msg, "unknown") || strings.Contains(msg, "not supported") || strings.Contains(msg, "unsupported")):
+		kind = ErrorInvalidOS
+	case strings.Contains(msg, "api key") || strings.Contains(msg, "invalid") || strings.Contains(msg, "wrong"):
+		kind = ErrorBadRequest
+	}
+	return &VulnersError{Code: code, Message: message, Kind: kind}
+}
+
+func (e *VulnersError) Error() string {
+	switch e.Kind {
+	case ErrorRateLimited:
+		return fmt.Sprintf("vulners rate limit is exceeded, set API key or decrease concurrency: %s (code %d)", e.Message, e.Code)
+	case ErrorInvalidOS:
+		return fmt.Sprintf("OS isn't supported by vulners: %s (code %d)", e.Message, e.Code)
+	case ErrorBadRequest:
+		return fmt.Sprintf("vulners rejected request, check API key and URL: %s (code %d)", e.Message, e.Code)
+	default:
+		return fmt.Sprintf("vulners err0r: %s (code %d)", e.Message, e.Code)
+	}
+}
+
+// ResponseBody contains response from vulners.com
+type ResponseBody struct {
+	Result string `json:"result"`
+	Data   struct {
+		Error           string   `json:"error"`
+		ErrorCode       int      `json:"errorCode"`
+		Vulnerabilities []string `json:"vulnerabilities"`
+		Reasons         []Reason `json:"reasons"`
+		Cvss            struct {
+			Score  float64 `json:"score"`
+			Vector string  `json:"vector"`
+		} `json:"cvss"`
+		Cvelist []string `json:"cvelist"`
+		ID      string   `json:"id"`
+	} `json:"data"`
+}
+
+// Auditor sends request to Vulners audit API and returns its response
+type Auditor interface {
+	Audit(ctx context.Context, rb *RequestBody) (*ResponseBody, error)
+}
+
+// AuditClient is Client that sends requests with Auditor and extracts vulnerabilities from responses
+type AuditClient struct {
+	Auditor Auditor
+	// Retries is number of retries if rate limit is exceeded, it's the only place where rate limits are retried
+	Retries int
+	Log     Logger
+}
+
+// NewClient creates Client that sends requests with provided Auditor
+func NewClient(auditor Auditor) *AuditClient {
+	return &AuditClient{
+		Auditor: auditor,
+		Retries: 2,
+		Log:     nopLogger{},
+	}
+}
+
+func (c *AuditClient) logger() Logger {
+	if c.Log == nil {
+		return nopLogger{}
+	}
+	return c.Log
+}
+
+// GetVulnerabilities sends packages to Vulners and returns found vulnerabilities.
+// Request is retried with backoff if rate limit is exceeded.
+func (c *AuditClient) GetVulnerabilities(ctx context.Context, rb *RequestBody) (*Vulnerabilities, error) {
+	ctx = withRequestID(ctx, newRequestID())
+	for attempt := 0; ; attempt++ {
+		// Rate limit is returned as error for 429 status and in body of other responses
+		body, err := c.Auditor.Audit(ctx, rb)
+		var vulns *Vulnerabilities
+		if err == nil {
+			vulns, err = c.extractVulnerabilitiesFromResponse(body)
+		}
+		var verr *VulnersError
+		if !errors.As(err, &verr) || verr.Kind != ErrorRateLimited || attempt >= c.Retries {
+			return vulns, err
+		}
+
+		c.logger().Warnf("Vulners rate limit is exceeded, retrying: %v", err)
+		wait := verr.RetryAfter
+		if wait == 0 {
+			wait = backoff(attempt)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// extractVulnerabilitiesFromResponse returns CVE and bulletin IDs from Vulners response
+func (c *AuditClient) extractVulnerabilitiesFromResponse(body *ResponseBody) (*Vulnerabilities, error) {
+	if body.Result != "OK" {
+		c.logger().Debugf("Vulners err0r: %s, error code %d", body.Data.Error, body.Data.ErrorCode)
+		return nil, newVulnersError(body.Data.ErrorCode, body.Data.Error)
+	}
+
+	result := &Vulnerabilities{
+		Cvss:       body.Data.Cvss.Score,
+		CvssVector: body.Data.Cvss.Vector,
+	}
+	result.CVE = body.Data.Cvelist
+	for _, v := range body.Data.Reasons {
+		result.Bulletins = append(result.Bulletins, v.BulletinID)
+		result.Reasons = append(result.Reasons, v)
+	}
+	return result, nil
+}
+
+// HTTPAuditor sends requests to Vulners audit API over HTTP
+type HTTPAuditor struct {
+	// URL of audit API, default is URL
+	URL string
+	// SoftwareURL is URL of software API used for language packages, NewHTTPAuditor sets it
+	// to software API on host of URL, default is SoftwareURL
+	SoftwareURL string
+	// FormatVersion is version of audit API that defines format of requests and responses, default is DefaultFormatVersion
+	FormatVersion string
+	// APIKey is added to every request if set
+	APIKey string
+	// UserAgent is sent with every request, default is DefaultUserAgent
+	UserAgent string
+	// Retries is number of retries for requests failed with network error or 5xx status,
+	// rate limits are retried by AuditClient
+	Retries int
+	HTTP    *http.Client
+	Log     Logger
+	// Limiter limits rate of requests including retries, it's shared by all requests of auditor
+	Limiter *rate.Limiter
+	// RequestLog receives every sent request as JSON line with time, container ID and HTTP status
+	RequestLog io.Writer
+	logMu      sync.Mutex
+}
+
+// NewHTTPAuditor creates auditor for Vulners requests. Proxy is taken from
+// HTTP_PROXY, HTTPS_PROXY and NO_PROXY variables unless proxy URL is provided.
+func NewHTTPAuditor(apiURL, apiKey, proxy string) (*HTTPAuditor, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyFromEnvironment
+	if proxy != "" {
+		u, err := url.Parse(proxy)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid proxy URL %q", proxy)
+		}
+		transport.Proxy = http.ProxyURL(u)
+	}
+	if apiURL == "" {
+		apiURL = URL
+	}
+
+	return &HTTPAuditor{
+		URL:         apiURL,
+		SoftwareURL: softwareURL(apiURL),
+		APIKey:      apiKey,
+		UserAgent:   DefaultUserAgent,
+		Retries:     2,
+		HTTP: &http.Client{
+			Timeout:   30 * time.Second,
+			Transport: transport,
+		},
+		Log: nopLogger{},
+	}, nil
+}
+
+// SetTLS makes auditor verify certificate of Vulners with CA certificates from PEM file in addition
+// to system pool, or skip verification completely if insecure is true
+func (a *HTTPAuditor) SetTLS(caFile string, insecure bool) error {
+	transport, ok := a.HTTP.Transport.(*http.Transport)
+	if !ok {
+		return errors.New("TLS can be configured only for default transport")
+	}
+	config := &tls.Config{InsecureSkipVerify: insecure}
+	if caFile != "" {
+		data, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return err
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(data) {
+			return fmt.Errorf("no certificates found in %s", caFile)
+		}
+		config.RootCAs = pool
+	}
+	transport.TLSClientConfig = config
+	return nil
+}
+
+// setUserAgent sets User-Agent header of request, Go default is used only if auditor has empty UserAgent
+func (a *HTTPAuditor) setUserAgent(req *http.Request) {
+	if a.UserAgent != "" {
+		req.Header.Set("User-Agent", a.UserAgent)
+	}
+}
+
+func (a *HTTPAuditor) logger() Logger {
+	if a.Log == nil {
+		return nopLogger{}
+	}
+	return a.Log
+}
+
+// Audit sends request to Vulners audit API and returns parsed response
+func (a *HTTPAuditor) Audit(ctx context.Context, rb *RequestBody) (*ResponseBody, error) {
+	request := *rb
+	if a.APIKey != "" {
+		request.APIKey = a.APIKey
+	}
+	format, err := getFormat(a.FormatVersion)
+	if err != nil {
+		return nil, err
+	}
+	data, err := format.encode(&request)
+	if err != nil {
+		return nil, err
+	}
+
+	requestID := requestIDFromContext(ctx)
+	a.logger().Debugf("Sending request %s to Vulners for container %s", requestID, ContainerIDFromContext(ctx))
+	resp, err := a.doWithRetry(ctx, http.MethodPost, a.URL, data, requestID)
+	if err != nil {
+		a.logRequest(ctx, request, requestID, "", 0, err)
+		return nil, err
+	}
+	serverID := resp.Header.Get(RequestIDHeader)
+	if serverID != "" && serverID != requestID {
+		a.logger().Debugf("Vulners returned request ID %s for request %s of container %s", serverID, requestID, ContainerIDFromContext(ctx))
+	}
+	a.logRequest(ctx, request, requestID, serverID, resp.StatusCode, nil)
+	defer func() {
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+
+	if request.APIKey != "" {
+		for _, h := range RateLimitHeaders {
+			if v := resp.Header.Get(h); v != "" {
+				a.logger().Infof("Vulners remaining quota: %s", v)
+				break
+			}
+		}
+	}
+
+	body, err := responseReader(resp)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		snippet, _ := ioutil.ReadAll(io.LimitReader(body, maxErrorBodySize))
+		var verr *VulnersError
+		if body, err := format.decode(snippet); err == nil && body.Data.Error != "" {
+			verr = newVulnersError(body.Data.ErrorCode, body.Data.Error)
+		} else if resp.StatusCode == http.StatusTooManyRequests {
+			verr = &VulnersError{Code: resp.StatusCode, Message: strings.TrimSpace(string(snippet))}
+		}
+		if verr != nil && resp.StatusCode == http.StatusTooManyRequests {
+			verr.Kind = ErrorRateLimited
+			verr.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"))
+		}
+		if verr != nil {
+			return nil, verr
+		}
+		return nil, fmt.Errorf("vulners returned %d for request %s: %s", resp.StatusCode, requestID, strings.TrimSpace(string(snippet)))
+	}
+
+	data, err = ioutil.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+
+	return format.decode(data)
+}
+
+// Ping checks that Vulners API is reachable. Any HTTP response means that API is reachable,
+// since audit API accepts only POST requests with packages.
+func (a *HTTPAuditor) Ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.URL, nil)
+	if err != nil {
+		return err
+	}
+	a.setUserAgent(req)
+	resp, err := a.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	return resp.Body.Close()
+}
+
+// responseReader returns reader for response body that decompresses it if Content-Encoding is gzip.
+// Transport decompresses response itself only if it added Accept-Encoding, but it's set explicitly for Vulners.
+func responseReader(resp *http.Response) (io.ReadCloser, error) {
+	if !strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		return ioutil.NopCloser(resp.Body), nil
+	}
+	zr, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("can't decompress Vulners response: %v", err)
+	}
+	return zr, nil
+}
+
+// doWithRetry sends request with body data to Vulners and retries it with exponential backoff
+// on network errors and 5xx responses
+func (a *HTTPAuditor) doWithRetry(ctx context.Context, method, url string, data []byte, requestID string) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		if a.Limiter != nil {
+			// Wait blocks until request is allowed and fails only if context is done
+			if err := a.Limiter.Wait(ctx); err != nil {
+				return nil, err
+			}
+		}
+		req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept-Encoding", "gzip")
+		req.Header.Set(RequestIDHeader, requestID)
+		a.setUserAgent(req)
+
+		resp, err := a.HTTP.Do(req)
+		if err != nil {
+			if ctx.Err() != nil || attempt >= a.Retries {
+				return nil, err
+			}
+			a.logger().Warnf("Request to Vulners failed, retrying: %v", err)
+		} else {
+			if !isRetryableStatus(resp.StatusCode) || attempt >= a.Retries {
+				return resp, nil
+			}
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+			a.logger().Warnf("Vulners returned %d, retrying", resp.StatusCode)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff(attempt)):
+		}
+	}
+}
+
+func isRetryableStatus(code int) bool {
+	return code >= 500
+}
+
+// backoff returns exponential delay with jitter for attempt
+func backoff(attempt int) time.Duration {
+	d := time.Second << uint(attempt)
+	if d > maxBackoff {
+		d = maxBackoff
+	}
+	return d + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// parseRetryAfter parses Retry-After header which contains either seconds or HTTP date
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if sec, err := strconv.Atoi(value); err == nil && sec > 0 {
+		return time.Duration(sec) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
@@ -0,0 +1,326 @@
+package scanner
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const auditResponse = `{
+	"result": "OK",
+	"data": {
+		"reasons": [
+			{
+				"package": "openssl",
+				"providedVersion": "1.1.1d-0+deb10u3",
+				"bulletinVersion": "1.1.1d-0+deb10u6",
+				"providedPackage": "openssl 1.1.1d-0+deb10u3 amd64",
+				"bulletinPackage": "openssl 1.1.1d-0+deb10u6",
+				"operator": "lt",
+				"bulletinID": "DSA-4855"
+			},
+			{
+				"package": "libssl1.1",
+				"providedVersion": "1.1.1d-0+deb10u3",
+				"bulletinVersion": "1.1.1d-0+deb10u6",
+				"providedPackage": "libssl1.1 1.1.1d-0+deb10u3 amd64",
+				"bulletinPackage": "libssl1.1 1.1.1d-0+deb10u6",
+				"operator": "lt",
+				"bulletinID": "DSA-4855"
+			}
+		],
+		"vulnerabilities": ["DSA-4855"],
+		"cvss": {"score": 5.9, "vector": "AV:N/AC:H/Au:N/C:N/I:N/A:C"},
+		"cvelist": ["CVE-2021-23840", "CVE-2021-23841"],
+		"id": "ABCDEF"
+	}
+}`
+
+func TestExtractVulnerabilitiesFromResponse(t *testing.T) {
+	var body ResponseBody
+	if err := json.Unmarshal([]byte(auditResponse), &body); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := NewClient(nil).extractVulnerabilitiesFromResponse(&body)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"CVE-2021-23840", "CVE-2021-23841"}; !reflect.DeepEqual(res.CVE, want) {
+		t.Errorf("CVE = %v, want %v", res.CVE, want)
+	}
+	if want := []string{"DSA-4855", "DSA-4855"}; !reflect.DeepEqual(res.Bulletins, want) {
+		t.Errorf("Bulletins = %v, want %v", res.Bulletins, want)
+	}
+	if len(res.Reasons) != 2 || res.Reasons[1].Package != "libssl1.1" {
+		t.Errorf("Reasons = %v, want reasons of openssl and libssl1.1", res.Reasons)
+	}
+	if res.Cvss != 5.9 || res.CvssVector != "AV:N/AC:H/Au:N/C:N/I:N/A:C" {
+		t.Errorf("CVSS = %v %q, want 5.9 with vector", res.Cvss, res.CvssVector)
+	}
+	if res.Count() != 4 {
+		t.Errorf("Count() = %d, want 4", res.Count())
+	}
+}
+
+func TestExtractVulnerabilitiesFromErrorResponse(t *testing.T) {
+	body := &ResponseBody{Result: "error"}
+	body.Data.Error = "Unknown OS windows"
+	body.Data.ErrorCode = 160
+
+	_, err := NewClient(nil).extractVulnerabilitiesFromResponse(body)
+	verr, ok := err.(*VulnersError)
+	if !ok {
+		t.Fatalf("error = %v, want VulnersError", err)
+	}
+	if verr.Kind != ErrorInvalidOS {
+		t.Errorf("Kind = %v, want ErrorInvalidOS", verr.Kind)
+	}
+}
+
+// proxyOf returns proxy host that auditor uses for Vulners request
+func proxyOf(t *testing.T, a *HTTPAuditor) string {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := a.HTTP.Transport.(*http.Transport).Proxy(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u == nil {
+		return ""
+	}
+	return u.Host
+}
+
+func TestNewHTTPAuditorProxy(t *testing.T) {
+	// ProxyFromEnvironment reads variables once per process, so they are set before the first request
+	t.Setenv("HTTPS_PROXY", "http://env-proxy:3128")
+	t.Setenv("NO_PROXY", "")
+
+	a, err := NewHTTPAuditor("", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := proxyOf(t, a); got != "env-proxy:3128" {
+		t.Errorf("proxy from environment = %q, want env-proxy:3128", got)
+	}
+
+	a, err = NewHTTPAuditor("", "", "http://flag-proxy:8080")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := proxyOf(t, a); got != "flag-proxy:8080" {
+		t.Errorf("proxy set with -proxy = %q, want flag-proxy:8080", got)
+	}
+
+	if _, err := NewHTTPAuditor("", "", "flag-proxy"); err == nil {
+		t.Error("expected error for proxy URL without host")
+	}
+}
+
+// fakeAuditor returns responses in order and repeats the last one, requests and their IDs are recorded
+type fakeAuditor struct {
+	responses []fakeAudit
+	requests  []*RequestBody
+	ids       []string
+}
+
+type fakeAudit struct {
+	body *ResponseBody
+	err  error
+}
+
+func (f *fakeAuditor) Audit(ctx context.Context, rb *RequestBody) (*ResponseBody, error) {
+	f.requests = append(f.requests, rb)
+	f.ids = append(f.ids, requestIDFromContext(ctx))
+	i := len(f.requests) - 1
+	if i >= len(f.responses) {
+		i = len(f.responses) - 1
+	}
+	return f.responses[i].body, f.responses[i].err
+}
+
+// okResponse returns OK response with provided CVE
+func okResponse(cvss float64, cve ...string) *ResponseBody {
+	body := &ResponseBody{Result: "OK"}
+	body.Data.Cvelist = cve
+	body.Data.Cvss.Score = cvss
+	return body
+}
+
+// rateLimited is error of 429 response that asks to retry after a millisecond, so tests don't wait for backoff
+var rateLimited = &VulnersError{Code: 429, Message: "Too many requests", Kind: ErrorRateLimited, RetryAfter: time.Millisecond}
+
+func TestAuditClientOK(t *testing.T) {
+	auditor := &fakeAuditor{responses: []fakeAudit{{body: okResponse(7.5, "CVE-2022-0778")}}}
+	rb := &RequestBody{Os: "ubuntu", Version: "20.04", Package: []string{"openssl 1.1.1f-1ubuntu2 amd64"}}
+
+	res, err := NewClient(auditor).GetVulnerabilities(context.Background(), rb)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(res.CVE, []string{"CVE-2022-0778"}) || res.Cvss != 7.5 {
+		t.Errorf("result = %+v, want CVE-2022-0778 with CVSS 7.5", res)
+	}
+	if len(auditor.requests) != 1 || auditor.requests[0] != rb {
+		t.Errorf("auditor got %d requests, want the request once", len(auditor.requests))
+	}
+}
+
+func TestAuditClientError(t *testing.T) {
+	auditErr := errors.New("connection refused")
+	auditor := &fakeAuditor{responses: []fakeAudit{{err: auditErr}}}
+
+	_, err := NewClient(auditor).GetVulnerabilities(context.Background(), &RequestBody{})
+	if !errors.Is(err, auditErr) {
+		t.Errorf("error = %v, want %v", err, auditErr)
+	}
+	if len(auditor.requests) != 1 {
+		t.Errorf("auditor got %d requests, errors other than rate limit shouldn't be retried", len(auditor.requests))
+	}
+
+	body := &ResponseBody{Result: "error"}
+	body.Data.Error = "Wrong API key"
+	auditor = &fakeAuditor{responses: []fakeAudit{{body: body}}}
+	_, err = NewClient(auditor).GetVulnerabilities(context.Background(), &RequestBody{})
+	var verr *VulnersError
+	if !errors.As(err, &verr) || verr.Kind != ErrorBadRequest {
+		t.Errorf("error = %v, want bad request", err)
+	}
+	if len(auditor.requests) != 1 {
+		t.Errorf("auditor got %d requests, want 1", len(auditor.requests))
+	}
+}
+
+func TestAuditClientRetriesRateLimit(t *testing.T) {
+	auditor := &fakeAuditor{responses: []fakeAudit{
+		{err: rateLimited},
+		{err: rateLimited},
+		{body: okResponse(5, "CVE-2021-3711")},
+	}}
+
+	res, err := NewClient(auditor).GetVulnerabilities(context.Background(), &RequestBody{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(res.CVE, []string{"CVE-2021-3711"}) {
+		t.Errorf("CVE = %v, want CVE-2021-3711", res.CVE)
+	}
+	if len(auditor.requests) != 3 {
+		t.Errorf("auditor got %d requests, want 3", len(auditor.requests))
+	}
+	if auditor.ids[0] != auditor.ids[1] || auditor.ids[1] != auditor.ids[2] {
+		t.Errorf("request IDs = %q, want the same ID for retries", auditor.ids)
+	}
+
+	if _, err := NewClient(auditor).GetVulnerabilities(context.Background(), &RequestBody{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if auditor.ids[3] == auditor.ids[0] {
+		t.Error("new request should have new ID")
+	}
+}
+
+func TestHTTPAuditorUsesRequestIDFromContext(t *testing.T) {
+	var got string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get(RequestIDHeader)
+		w.Write([]byte(auditResponse))
+	}))
+	defer server.Close()
+
+	a, err := NewHTTPAuditor(server.URL, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.HTTP.Transport.(*http.Transport).Proxy = nil
+	if _, err := a.Audit(withRequestID(context.Background(), "retried-id"), &RequestBody{Os: "debian", Version: "10"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != "retried-id" {
+		t.Errorf("%s = %q, want ID from context", RequestIDHeader, got)
+	}
+}
+
+func TestAuditClientRateLimitRetriesExhausted(t *testing.T) {
+	auditor := &fakeAuditor{responses: []fakeAudit{{err: rateLimited}}}
+	client := NewClient(auditor)
+	client.Retries = 1
+
+	_, err := client.GetVulnerabilities(context.Background(), &RequestBody{})
+	if !errors.Is(err, rateLimited) {
+		t.Errorf("error = %v, want rate limit error", err)
+	}
+	if len(auditor.requests) != 2 {
+		t.Errorf("auditor got %d requests, want 2", len(auditor.requests))
+	}
+}
+
+func TestNewHTTPAuditorSoftwareURL(t *testing.T) {
+	tests := []struct{ apiURL, want string }{
+		{"", SoftwareURL},
+		{"https://vulners.example.com/api/v3/audit/audit/", "https://vulners.example.com/api/v3/burp/software/"},
+		{"http://10.0.0.5:8080/vulners/api/v4/audit/audit/", "http://10.0.0.5:8080/vulners/api/v3/burp/software/"},
+	}
+	for _, tt := range tests {
+		a, err := NewHTTPAuditor(tt.apiURL, "", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a.SoftwareURL != tt.want {
+			t.Errorf("SoftwareURL for %q = %q, want %q", tt.apiURL, a.SoftwareURL, tt.want)
+		}
+	}
+}
+
+func TestSetTLSLoadsCA(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := ioutil.WriteFile(caFile, cert, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := NewHTTPAuditor(server.URL, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	transport := a.HTTP.Transport.(*http.Transport)
+	transport.Proxy = nil
+	if err := a.Ping(context.Background()); err == nil {
+		t.Fatal("certificate of test server shouldn't be trusted without CA bundle")
+	}
+
+	if err := a.SetTLS(caFile, false); err != nil {
+		t.Fatal(err)
+	}
+	if transport.TLSClientConfig == nil || transport.TLSClientConfig.RootCAs == nil {
+		t.Fatal("CA bundle isn't set as RootCAs of transport")
+	}
+	if transport.TLSClientConfig.InsecureSkipVerify {
+		t.Error("verification shouldn't be skipped")
+	}
+	if err := a.Ping(context.Background()); err != nil {
+		t.Errorf("request with CA bundle failed: %v", err)
+	}
+
+	empty := filepath.Join(t.TempDir(), "empty.pem")
+	if err := ioutil.WriteFile(empty, []byte("not a certificate\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.SetTLS(empty, false); err == nil {
+		t.Error("expected error for file without certificates")
+	}
+}
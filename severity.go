@@ -0,0 +1,60 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/artemnikitin/vulnedock/scanner"
+)
+
+// severityRanks orders severities returned by severityFromScore
+var severityRanks = map[string]int{
+	"none":     0,
+	"low":      1,
+	"medium":   2,
+	"high":     3,
+	"critical": 4,
+}
+
+// severityFromScore returns severity for CVSS score according to CVSS v3 ratings
+func severityFromScore(score float64) string {
+	switch {
+	case score >= 9:
+		return "critical"
+	case score >= 7:
+		return "high"
+	case score >= 4:
+		return "medium"
+	case score > 0:
+		return "low"
+	default:
+		return "none"
+	}
+}
+
+// severityLabel returns capitalized severity for CVSS score, e.g. "High"
+func severityLabel(score float64) string {
+	s := severityFromScore(score)
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+// failingResult returns result with the highest CVSS score among results with findings
+// at or above level, "any" matches any finding and "none" never matches
+func failingResult(results []*scanner.ContainerResult, level string) *scanner.ContainerResult {
+	if level == "none" {
+		return nil
+	}
+	var worst *scanner.ContainerResult
+	for _, res := range results {
+		if res.Count() == 0 {
+			continue
+		}
+		// Findings of language packages have own scores
+		if level != "any" && severityRanks[severityFromScore(res.MaxCvss())] < severityRanks[level] {
+			continue
+		}
+		if worst == nil || res.MaxCvss() > worst.MaxCvss() {
+			worst = res
+		}
+	}
+	return worst
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// dockerSockets returns paths where Docker socket is usually found, including paths it's mounted to
+// when vulnedock itself runs in container and sockets of rootless Docker and Docker Desktop
+func dockerSockets() []string {
+	paths := []string{
+		"/var/run/docker.sock",
+		"/run/docker.sock",
+		"/host/var/run/docker.sock",
+		"/var/run/docker/docker.sock",
+		"/docker.sock",
+	}
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		paths = append(paths, filepath.Join(dir, "docker.sock"))
+	}
+	paths = append(paths, fmt.Sprintf("/run/user/%d/docker.sock", os.Getuid()))
+	if home, err := os.UserHomeDir(); err == nil {
+		paths = append(paths, filepath.Join(home, ".docker", "run", "docker.sock"))
+	}
+	return paths
+}
+
+// detectDockerSocket returns the first existing socket from dockerSockets or empty string if there is none
+func detectDockerSocket() string {
+	for _, p := range dockerSockets() {
+		if info, err := os.Stat(p); err == nil && info.Mode()&os.ModeSocket != 0 {
+			return p
+		}
+	}
+	return ""
+}
+
+// socketPermissionHint returns advice for error of connection to Docker socket if socket exists
+// but current user can't access it, otherwise it returns empty string
+func socketPermissionHint(host string, err error) string {
+	if !strings.HasPrefix(host, "unix://") || !strings.Contains(strings.ToLower(err.Error()), "permission denied") {
+		return ""
+	}
+	path := strings.TrimPrefix(host, "unix://")
+	return fmt.Sprintf("user can't access Docker socket %s, add user to group of the socket, e.g. usermod -aG docker $USER, "+
+		"or run vulnedock container with --group-add $(stat -c %%g %s)", path, path)
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/artemnikitin/vulnedock/scanner"
+)
+
+// summary contains aggregated results of scan for all containers
+type summary struct {
+	Scanned int
+	Failed  int
+	// ExecDenied is number of containers skipped because exec isn't permitted
+	ExecDenied int
+	// TimedOut is number of containers skipped because scan exceeded -timeout-per-container
+	TimedOut    int
+	Clean       int
+	Vulnerable  int
+	DistinctCVE int
+	TopCVE      []cveCount
+	// ExecP50, ExecP95, VulnersP50 and VulnersP95 are percentiles of latency in milliseconds,
+	// containers that shared result of another container aren't included
+	ExecP50, ExecP95       int64
+	VulnersP50, VulnersP95 int64
+	// VulnerableByImage contains number of vulnerable containers for every image, results without image,
+	// e.g. of -packages-file, aren't counted
+	VulnerableByImage map[string]int
+	// Services contains results grouped by service of containers, containers without service aren't included
+	Services map[string]*serviceSummary
+}
+
+// serviceSummary contains aggregated results of containers of one service
+type serviceSummary struct {
+	Containers  int
+	Vulnerable  int
+	DistinctCVE int
+	cve         map[string]bool
+}
+
+type cveCount struct {
+	CVE        string
+	Containers int
+}
+
+// summarize aggregates results, top is the number of the most frequent CVE to include
+func summarize(results []*scanner.ContainerResult, run *scanRun, top int) summary {
+	s := summary{
+		Scanned:           len(results),
+		Failed:            run.Failed,
+		ExecDenied:        run.ExecDenied,
+		TimedOut:          run.TimedOut,
+		VulnerableByImage: make(map[string]int),
+		Services:          make(map[string]*serviceSummary),
+	}
+
+	counts := make(map[string]int)
+	var execLatency, vulnersLatency []int64
+	for _, res := range results {
+		if res.ExecLatencyMs > 0 {
+			execLatency = append(execLatency, res.ExecLatencyMs)
+		}
+		if res.Request != nil {
+			continue
+		}
+		if res.VulnersLatencyMs > 0 {
+			vulnersLatency = append(vulnersLatency, res.VulnersLatencyMs)
+		}
+		if res.Count() == 0 {
+			s.Clean++
+		} else {
+			s.Vulnerable++
+			if res.Image != "" {
+				s.VulnerableByImage[res.Image]++
+			}
+		}
+		if res.Service != "" {
+			svc := s.Services[res.Service]
+			if svc == nil {
+				svc = &serviceSummary{cve: make(map[string]bool)}
+				s.Services[res.Service] = svc
+			}
+			svc.Containers++
+			if res.Count() > 0 {
+				svc.Vulnerable++
+			}
+			for _, cve := range resultCVE(res) {
+				svc.cve[cve] = true
+			}
+			svc.DistinctCVE = len(svc.cve)
+		}
+		seen := make(map[string]bool)
+		for _, cve := range resultCVE(res) {
+			if !seen[cve] {
+				seen[cve] = true
+				counts[cve]++
+			}
+		}
+	}
+
+	s.ExecP50, s.ExecP95 = percentile(execLatency, 50), percentile(execLatency, 95)
+	s.VulnersP50, s.VulnersP95 = percentile(vulnersLatency, 50), percentile(vulnersLatency, 95)
+	s.DistinctCVE = len(counts)
+	for cve, n := range counts {
+		s.TopCVE = append(s.TopCVE, cveCount{CVE: cve, Containers: n})
+	}
+	sort.Slice(s.TopCVE, func(i, j int) bool {
+		if s.TopCVE[i].Containers != s.TopCVE[j].Containers {
+			return s.TopCVE[i].Containers > s.TopCVE[j].Containers
+		}
+		return s.TopCVE[i].CVE < s.TopCVE[j].CVE
+	})
+	if len(s.TopCVE) > top {
+		s.TopCVE = s.TopCVE[:top]
+	}
+	return s
+}
+
+// resultCVE returns CVE of OS packages and language packages of container
+func resultCVE(res *scanner.ContainerResult) []string {
+	result := append([]string(nil), res.CVE...)
+	for _, lang := range res.Languages {
+		result = append(result, lang.CVE...)
+	}
+	return result
+}
+
+// percentile returns nearest-rank percentile p of values, values are sorted in place
+func percentile(values []int64, p int) int64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	rank := (p*len(values) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return values[rank-1]
+}
+
+func printSummary(w io.Writer, s summary) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "Summary:")
+	fmt.Fprintf(tw, "Containers scanned\t%d\n", s.Scanned)
+	fmt.Fprintf(tw, "Failed to scan\t%d\n", s.Failed)
+	if s.ExecDenied > 0 {
+		fmt.Fprintf(tw, "Exec not permitted\t%d\n", s.ExecDenied)
+	}
+	if s.TimedOut > 0 {
+		fmt.Fprintf(tw, "Timed out\t%d\n", s.TimedOut)
+	}
+	fmt.Fprintf(tw, "Clean\t%d\n", s.Clean)
+	fmt.Fprintf(tw, "Vulnerable\t%d\n", s.Vulnerable)
+	fmt.Fprintf(tw, "Distinct CVE\t%d\n", s.DistinctCVE)
+	if s.ExecP50 > 0 {
+		fmt.Fprintf(tw, "Exec latency p50/p95\t%dms/%dms\n", s.ExecP50, s.ExecP95)
+	}
+	if s.VulnersP50 > 0 {
+		fmt.Fprintf(tw, "Vulners latency p50/p95\t%dms/%dms\n", s.VulnersP50, s.VulnersP95)
+	}
+	if len(s.TopCVE) > 0 {
+		fmt.Fprintln(tw, "Most frequent CVE:\t")
+		for _, v := range s.TopCVE {
+			fmt.Fprintf(tw, "%s\t%d containers\n", v.CVE, v.Containers)
+		}
+	}
+	if len(s.VulnerableByImage) > 0 {
+		images := make([]string, 0, len(s.VulnerableByImage))
+		for k := range s.VulnerableByImage {
+			images = append(images, k)
+		}
+		sort.Strings(images)
+		fmt.Fprintln(tw, "Vulnerable containers by image:\t")
+		for _, v := range images {
+			fmt.Fprintf(tw, "%s\t%d containers\n", v, s.VulnerableByImage[v])
+		}
+	}
+	if len(s.Services) > 0 {
+		services := make([]string, 0, len(s.Services))
+		for k := range s.Services {
+			services = append(services, k)
+		}
+		sort.Strings(services)
+		fmt.Fprintln(tw, "By service:\t")
+		for _, v := range services {
+			svc := s.Services[v]
+			fmt.Fprintf(tw, "%s\t%d containers, %d vulnerable, %d distinct CVE\n", v, svc.Containers, svc.Vulnerable, svc.DistinctCVE)
+		}
+	}
+	return tw.Flush()
+}
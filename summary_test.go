@@ -0,0 +1,22 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/artemnikitin/vulnedock/scanner"
+)
+
+func TestSummarizeSkipsResultsWithoutImage(t *testing.T) {
+	vulns := scanner.Vulnerabilities{CVE: []string{"CVE-2022-0778"}, Cvss: 7.5}
+	results := []*scanner.ContainerResult{
+		{ID: "packages.txt", OS: "debian", Version: "11", Vulnerabilities: vulns},
+		{ID: "c1", Image: "nginx:1.21", Vulnerabilities: vulns},
+	}
+	s := summarize(results, &scanRun{Results: results, Scanned: 2}, 10)
+	if s.Vulnerable != 2 {
+		t.Errorf("Vulnerable = %d, want 2", s.Vulnerable)
+	}
+	if _, ok := s.VulnerableByImage[""]; ok || s.VulnerableByImage["nginx:1.21"] != 1 {
+		t.Errorf("VulnerableByImage = %v, want only nginx:1.21", s.VulnerableByImage)
+	}
+}